@@ -7,18 +7,24 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"os/user"
 	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/keybase/bot-sshca/src/keybaseca/constants"
 
 	"github.com/google/uuid"
 
+	"github.com/keybase/bot-sshca/src/keybaseca/audit"
 	"github.com/keybase/bot-sshca/src/keybaseca/bot"
+	"github.com/keybase/bot-sshca/src/keybaseca/casigner"
 	"github.com/keybase/bot-sshca/src/keybaseca/config"
-	klog "github.com/keybase/bot-sshca/src/keybaseca/log"
+	"github.com/keybase/bot-sshca/src/keybaseca/profiles"
+	"github.com/keybase/bot-sshca/src/keybaseca/revocation"
+	"github.com/keybase/bot-sshca/src/keybaseca/rotation"
 	"github.com/keybase/bot-sshca/src/keybaseca/sshutils"
 	"github.com/keybase/bot-sshca/src/kssh"
 	"github.com/keybase/bot-sshca/src/shared"
@@ -27,6 +33,16 @@ import (
 	"github.com/urfave/cli"
 )
 
+// The supported values for the `sign --output-mode` flag. "file" is the long-standing behavior of
+// writing the certificate next to the public key on disk; "agent" and "stdout-bundle" are the
+// disk-free modes that hand the cert (and, for agent/stdout-bundle, a freshly generated key) back
+// without ever touching `~/.ssh`.
+const (
+	outputModeFile         = "file"
+	outputModeAgent        = "agent"
+	outputModeStdoutBundle = "stdout-bundle"
+)
+
 var VersionNumber = "master"
 
 func main() {
@@ -58,8 +74,21 @@ func main() {
 			Before: beforeAction,
 		},
 		{
-			Name:   "generate",
-			Usage:  "Generate a new CA key",
+			Name:  "generate",
+			Usage: "Generate a new CA key",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "backend",
+					Value: string(casigner.BackendFile),
+					Usage: "Where the new CA key should be provisioned: `file` (default), `pkcs11`, `aws-kms`, or `gcp-kms`",
+				},
+				cli.StringFlag{
+					Name: "backend-location",
+					Usage: "Backend-specific key location: `<module-path>#<slot>#<key-label>` for " +
+						"--backend=pkcs11, or a key description/key ring for --backend=aws-kms/gcp-kms. " +
+						"Ignored for --backend=file, which always writes to CA_KEY_LOCATION",
+				},
+			},
 			Action: generateAction,
 			Before: beforeAction,
 		},
@@ -69,23 +98,132 @@ func main() {
 			Action: serviceAction,
 			Before: beforeAction,
 		},
+		{
+			Name:  "rotate",
+			Usage: "Rotate the CA key, publishing both the old and new keys as trusted during a grace period",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "grace-period",
+					Value: 24 * time.Hour,
+					Usage: "How long both the old and new CA public keys remain trusted after rotation, " +
+						"giving unrotated servers time to pick up the new key",
+				},
+				cli.BoolFlag{
+					Name:  "end-grace-period",
+					Usage: "Instead of starting a new rotation, drop the old CA key from the published " +
+						"trust bundle for a rotation whose grace period has elapsed",
+				},
+			},
+			Action: rotateAction,
+			Before: beforeAction,
+		},
 		{
 			Name:  "sign",
 			Usage: "Sign a given public key with all permissions without a dependency on Keybase",
 			Flags: []cli.Flag{
 				cli.StringFlag{
-					Name:     "public-key",
-					Usage:    "The path to the public key you wish to sign. Eg `~/.ssh/id_rsa.pub`",
-					Required: true,
+					Name: "public-key",
+					Usage: "The path to the public key you wish to sign. Eg `~/.ssh/id_rsa.pub`. Required " +
+						"when --output-mode=file; ignored for --output-mode=agent/stdout-bundle, which " +
+						"generate their own ephemeral keypair instead.",
 				},
 				cli.BoolFlag{
 					Name:  "overwrite",
 					Usage: "Overwrite the existing certificate on the filesystem",
 				},
+				cli.StringFlag{
+					Name:  "output-mode",
+					Value: outputModeFile,
+					Usage: "Where to deliver the signed certificate: `file` (write next to the public key), " +
+						"`agent` (load cert+key into SSH_AUTH_SOCK, no disk writes), or `stdout-bundle` " +
+						"(print a self-contained identity bundle as JSON; the JSON itself is not a key file " +
+						"that `ssh -i` reads)",
+				},
+				cli.StringFlag{
+					Name:  "profile",
+					Usage: "Name of a profile from --profiles-config to sign with, instead of granting all teams/permissions",
+				},
+				cli.StringFlag{
+					Name:  "profiles-config",
+					Usage: "Path to a YAML file with a top-level `profiles:` block, required when --profile is set",
+				},
 			},
 			Action: signAction,
 			Before: beforeAction,
 		},
+		{
+			Name:  "sign-host",
+			Usage: "Sign a host public key, producing an OpenSSH host certificate",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:     "public-key",
+					Usage:    "The path to the host public key you wish to sign. Eg `/etc/ssh/ssh_host_ed25519_key.pub`",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:     "hostnames",
+					Usage:    "Comma separated list of DNS names (and/or IPs) this certificate is valid for",
+					Required: true,
+				},
+				cli.BoolFlag{
+					Name:  "overwrite",
+					Usage: "Overwrite the existing host certificate on the filesystem",
+				},
+			},
+			Action: signHostAction,
+			Before: beforeAction,
+		},
+		{
+			Name:  "provision-host",
+			Usage: "Sign a host key and install the resulting host cert and TrustedUserCAKeys file under an sshd config directory",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:     "public-key",
+					Usage:    "The path to the host public key to sign, eg `/etc/ssh/ssh_host_ed25519_key.pub`",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:     "hostnames",
+					Usage:    "Comma separated list of DNS names (and/or IPs) this certificate is valid for",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:  "sshd-dir",
+					Value: "/etc/ssh",
+					Usage: "The sshd configuration directory to install the host cert and TrustedUserCAKeys file into",
+				},
+			},
+			Action: provisionHostAction,
+			Before: beforeAction,
+		},
+		{
+			Name:  "revoke",
+			Usage: "Revoke a previously issued certificate by key ID or by the Keybase user it was issued to",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "key-id",
+					Usage: "The key ID of the certificate to revoke, as recorded in the issuance index",
+				},
+				cli.StringFlag{
+					Name:  "principal",
+					Usage: "Revoke every certificate issued to this Keybase user",
+				},
+			},
+			Action: revokeAction,
+			Before: beforeAction,
+		},
+		{
+			Name:  "audit",
+			Usage: "Inspect the CA's tamper-evident audit log",
+			Subcommands: []cli.Command{
+				{
+					Name:   "verify",
+					Usage:  "Walk the audit log, recomputing the hash chain and signatures, and report any gap or tampering",
+					Action: auditVerifyAction,
+					Before: beforeAction,
+				},
+			},
+		},
 	}
 	app.Action = mainAction
 	err := app.Run(os.Args)
@@ -111,11 +249,19 @@ func backupAction(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	bytes, err := ioutil.ReadFile(conf.GetCAKeyLocation())
+	signer, err := loadConfiguredCASigner(conf)
+	if err != nil {
+		return err
+	}
+	if !signer.Exportable() {
+		return fmt.Errorf("the configured CA key backend (%s) does not support exporting the private key; "+
+			"back up the %s key material using that backend's own tooling instead", currentCABackend(), currentCABackendLocation(conf))
+	}
+	bytes, err := signer.Export()
 	if err != nil {
-		return fmt.Errorf("Failed to load the CA key from %s: %v", conf.GetCAKeyLocation(), err)
+		return fmt.Errorf("Failed to export the CA key: %v", err)
 	}
-	klog.Log(conf, "Exported CA key to stdout")
+	auditLog(conf, signer, "backup", "", "", "", "")
 	fmt.Println("\nKeep this key somewhere very safe. We recommend keeping a physical copy of it in a secure place.")
 	fmt.Println("")
 	fmt.Println(string(bytes))
@@ -129,10 +275,144 @@ func generateAction(c *cli.Context) error {
 		return err
 	}
 	captureControlCToDeleteClientConfig(conf)
-	err = sshutils.Generate(conf, strings.ToLower(os.Getenv("FORCE_WRITE")) == "true")
+
+	backend := casigner.Backend(c.String("backend"))
+	if backend != casigner.BackendFile && backend != "" {
+		// Provision a brand new key inside the chosen KMS/HSM instead of writing PEM to disk.
+		_, resultingLocation, err := casigner.Create(backend, c.String("backend-location"))
+		if err != nil {
+			return fmt.Errorf("Failed to provision a new key with backend %s: %v", backend, err)
+		}
+		fmt.Printf("Provisioned a new CA key in backend %s at %s\n", backend, resultingLocation)
+		fmt.Printf("Set CA_KEY_BACKEND=%s and CA_KEY_BACKEND_LOCATION=%s for every later keybaseca invocation.\n",
+			backend, resultingLocation)
+		return nil
+	}
+
+	err = sshutils.Generate(conf.GetCAKeyLocation(), strings.ToLower(os.Getenv("FORCE_WRITE")) == "true")
 	if err != nil {
 		return fmt.Errorf("Failed to generate a new key: %v", err)
 	}
+	if signer, signerErr := loadConfiguredCASigner(conf); signerErr == nil {
+		auditLog(conf, signer, "generate", "", "", "", "")
+	}
+	return nil
+}
+
+// auditLogLocation is where the audit log for conf's CA lives: alongside the CA key's log file,
+// distinguished by an ".audit" suffix.
+func auditLogLocation(conf config.Config) string {
+	return conf.GetLogLocation() + ".audit"
+}
+
+// auditLog appends a best-effort record to the audit log. Failing to audit-log an event is logged
+// as a warning rather than surfaced as a command failure, since the event it's recording has
+// already happened by the time this is called.
+func auditLog(conf config.Config, signer casigner.CASigner, action, keyID, principals, expiration, pubkeyFingerprint string) {
+	actor, err := bot.GetUsername(conf)
+	if err != nil {
+		actor = "unknown"
+	}
+	err = audit.NewLogger(auditLogLocation(conf), signer).Append(actor, action, keyID, principals, expiration, pubkeyFingerprint)
+	if err != nil {
+		logrus.Warnf("Failed to append audit log record for %s: %v", action, err)
+	}
+}
+
+// The action for the `keybaseca revoke` subcommand
+func revokeAction(c *cli.Context) error {
+	conf, err := loadServerConfig()
+	if err != nil {
+		return err
+	}
+
+	keyID := c.String("key-id")
+	principal := c.String("principal")
+	if (keyID == "") == (principal == "") {
+		return fmt.Errorf("Exactly one of --key-id or --principal must be given")
+	}
+
+	var serial uint64
+	if keyID != "" {
+		serial, err = revocation.RevokeByKeyID(conf, keyID)
+	} else {
+		serial, err = revocation.RevokeByPrincipal(conf, principal)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to revoke: %v", err)
+	}
+
+	if signer, signerErr := loadConfiguredCASigner(conf); signerErr == nil {
+		auditLog(conf, signer, "revoke", keyID, principal, "", "")
+	}
+	fmt.Printf("Published revocation serial %d. kssh and sshd will pick up the updated KRL on their next refresh.\n", serial)
+	return nil
+}
+
+// The action for the `keybaseca audit verify` subcommand
+func auditVerifyAction(c *cli.Context) error {
+	conf, err := loadServerConfig()
+	if err != nil {
+		return err
+	}
+	signer, err := loadConfiguredCASigner(conf)
+	if err != nil {
+		return err
+	}
+	records, err := audit.Verify(auditLogLocation(conf), signer.Public())
+	if err != nil {
+		return fmt.Errorf("Audit log verification FAILED: %v", err)
+	}
+	fmt.Printf("Audit log OK: verified %d record(s), hash chain and signatures intact.\n", len(records))
+	return nil
+}
+
+// loadConfiguredCASigner loads the CASigner for whichever CA key backend is currently configured
+// (CA_KEY_BACKEND / CA_KEY_BACKEND_LOCATION in the environment, defaulting to the on-disk file at
+// conf.GetCAKeyLocation()).
+func loadConfiguredCASigner(conf config.Config) (casigner.CASigner, error) {
+	signer, err := casigner.Load(currentCABackend(), currentCABackendLocation(conf))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the configured CA key backend: %v", err)
+	}
+	return signer, nil
+}
+
+func currentCABackend() casigner.Backend {
+	return casigner.Backend(os.Getenv("CA_KEY_BACKEND"))
+}
+
+func currentCABackendLocation(conf config.Config) string {
+	if location := os.Getenv("CA_KEY_BACKEND_LOCATION"); location != "" {
+		return location
+	}
+	return conf.GetCAKeyLocation()
+}
+
+// The action for the `keybaseca rotate` subcommand
+func rotateAction(c *cli.Context) error {
+	conf, err := loadServerConfig()
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("end-grace-period") {
+		manifest, err := rotation.EndGracePeriod(conf)
+		if err != nil {
+			return fmt.Errorf("Failed to end rotation grace period: %v", err)
+		}
+		fmt.Printf("Old CA key (%s) is no longer trusted; only %s is now published.\n",
+			manifest.OldKeyFingerprint, manifest.NewKeyFingerprint)
+		return nil
+	}
+
+	manifest, err := rotation.Rotate(conf, c.Duration("grace-period"))
+	if err != nil {
+		return fmt.Errorf("Failed to rotate CA key: %v", err)
+	}
+	fmt.Printf("Rotated CA key: %s -> %s\n", manifest.OldKeyFingerprint, manifest.NewKeyFingerprint)
+	fmt.Printf("Both keys are trusted until %s. Run `keybaseca rotate --end-grace-period` after that "+
+		"to finish the rotation.\n", manifest.GraceDeadline)
 	return nil
 }
 
@@ -143,7 +423,13 @@ func serviceAction(c *cli.Context) error {
 		return err
 	}
 	captureControlCToDeleteClientConfig(conf)
+	if signer, err := loadConfiguredCASigner(conf); err == nil {
+		auditLog(conf, signer, "service-start", "", "", "", "")
+	}
 	err = bot.StartBot(conf)
+	if signer, signerErr := loadConfiguredCASigner(conf); signerErr == nil {
+		auditLog(conf, signer, "service-stop", "", "", "", "")
+	}
 	if err != nil {
 		return fmt.Errorf("CA chatbot crashed: %v", err)
 	}
@@ -158,42 +444,282 @@ func signAction(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("Invalid config: %v", err)
 	}
+	outputMode := c.String("output-mode")
+	if outputMode != outputModeFile && outputMode != outputModeAgent && outputMode != outputModeStdoutBundle {
+		return fmt.Errorf("Unsupported --output-mode %q, expected one of file/agent/stdout-bundle", outputMode)
+	}
+
 	principals := strings.Join(conf.GetTeams(), ",")
 	expiration := conf.GetKeyExpiration()
 	randomUUID, err := uuid.NewRandom()
 	if err != nil {
 		return fmt.Errorf("Failed to generate unique key ID: %v", err)
 	}
+	keyID := randomUUID.String() + ":keybaseca-sign"
+
+	var activeProfile *profiles.Profile
+	if profileName := c.String("profile"); profileName != "" {
+		profilesConfigPath := c.String("profiles-config")
+		if profilesConfigPath == "" {
+			return fmt.Errorf("--profiles-config is required when --profile is set")
+		}
+		available, err := profiles.LoadProfiles(profilesConfigPath)
+		if err != nil {
+			return err
+		}
+		kbUser, err := currentOSUsername()
+		if err != nil {
+			return fmt.Errorf("Failed to determine the local user to template profile principals with: %v", err)
+		}
+		// This CLI path has no dependency on Keybase (see its Usage string), so there is no real
+		// per-request identity to check a profile's allowed teams against -- whoever can run this
+		// command already has access to the CA key, which is a stronger grant than any profile.
+		// profiles.Get looks the profile up by name only; the team-membership check that actually
+		// gates access (profiles.Select) is enforced in bot.StartBot, where the requester is a real
+		// Keybase user.
+		selected, err := profiles.Get(available, profileName)
+		if err != nil {
+			return err
+		}
+		activeProfile = selected
+		principals = selected.RenderPrincipals(kbUser)
+		keyID = selected.RenderKeyID(kbUser)
+		if selected.Validity != "" {
+			expiration = selected.Validity
+		}
+	}
+
+	signer, err := loadConfiguredCASigner(&conf)
+	if err != nil {
+		return fmt.Errorf("Failed to load the configured CA key: %v", err)
+	}
+
+	if outputMode == outputModeFile {
+		// Read the public key from the specified file
+		filename := c.String("public-key")
+		if filename == "" {
+			return fmt.Errorf("--public-key is required when --output-mode=file")
+		}
+		pubKey, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("Failed to read file at %s to get the public key: %v", filename, err)
+		}
+
+		// Sign the public key
+		signature, err := signPublicKey(signer, keyID, principals, expiration, string(pubKey), activeProfile)
+		if err != nil {
+			return fmt.Errorf("Failed to sign key: %v", err)
+		}
+		if fingerprint, fpErr := sshutils.FingerprintPublicKey(string(pubKey)); fpErr == nil {
+			auditLog(&conf, signer, "sign", keyID, principals, expiration, fingerprint)
+			recordIssuance(&conf, keyID, principals, expiration, fingerprint)
+		}
+
+		// Either store it in a file or print it to stdout
+		certPath := shared.KeyPathToCert(shared.PubKeyPathToKeyPath(filename))
+		_, err = os.Stat(certPath)
+		if os.IsNotExist(err) || c.Bool("overwrite") {
+			err = ioutil.WriteFile(certPath, []byte(signature), 0600)
+			if err != nil {
+				return fmt.Errorf("Failed to write certificate to file: %v", err)
+			}
+			fmt.Printf("Provisioned new certificate in %s\n", certPath)
+		} else {
+			fmt.Printf("Provisioned new certificate. Place this in %s in order to use it with ssh.\n", certPath)
+			fmt.Printf("\n```\n%s```\n", signature)
+		}
+		return nil
+	}
+
+	// agent/stdout-bundle never touch disk: generate an ephemeral keypair, sign it, and hand the
+	// key+cert (plus the CA public key a client should trust) back directly.
+	privateKeyPEM, authorizedKey, err := sshutils.GenerateEphemeralKeypair()
+	if err != nil {
+		return fmt.Errorf("Failed to generate ephemeral keypair: %v", err)
+	}
+	signature, err := signPublicKey(signer, keyID, principals, expiration, authorizedKey, activeProfile)
+	if err != nil {
+		return fmt.Errorf("Failed to sign key: %v", err)
+	}
+	caPublicKeys, err := sshutils.LoadCAPublicKeys(conf.GetCAKeyLocation())
+	if err != nil {
+		return fmt.Errorf("Failed to load CA public key: %v", err)
+	}
+	bundle := sshutils.IdentityBundle{
+		PrivateKeyPEM:  privateKeyPEM,
+		CertificatePEM: signature,
+		CAPublicKeys:   caPublicKeys,
+	}
+	if fingerprint, fpErr := sshutils.FingerprintPublicKey(authorizedKey); fpErr == nil {
+		auditLog(&conf, signer, "sign", keyID, principals, expiration, fingerprint)
+		recordIssuance(&conf, keyID, principals, expiration, fingerprint)
+	}
+
+	switch outputMode {
+	case outputModeAgent:
+		lifetime, err := time.ParseDuration(strings.TrimPrefix(expiration, "+"))
+		if err != nil {
+			return fmt.Errorf("Failed to parse key expiration %q as a duration: %v", expiration, err)
+		}
+		err = sshutils.LoadIntoAgent(bundle, lifetime)
+		if err != nil {
+			return fmt.Errorf("Failed to load certificate into ssh-agent: %v", err)
+		}
+		fmt.Println("Loaded certificate into ssh-agent; it will expire from the agent automatically.")
+	case outputModeStdoutBundle:
+		bytes, err := bundle.MarshalBundle()
+		if err != nil {
+			return fmt.Errorf("Failed to marshal identity bundle: %v", err)
+		}
+		fmt.Println(string(bytes))
+	}
+	return nil
+}
+
+// signPublicKey signs pubKey either with the unrestricted default behavior (SignKey) or, when
+// activeProfile is set, with that profile's principals/extensions/critical options
+// (SignKeyWithProfile). signer is whichever CA key backend is currently configured.
+func signPublicKey(signer casigner.CASigner, keyID, principals, expiration, pubKey string, activeProfile *profiles.Profile) (string, error) {
+	if activeProfile == nil {
+		return sshutils.SignKey(signer, keyID, principals, expiration, pubKey)
+	}
+	return sshutils.SignKeyWithProfile(signer, keyID, principals, expiration, pubKey,
+		activeProfile.Extensions, activeProfile.CriticalOptions)
+}
+
+// recordIssuance best-effort records a newly signed certificate in the revocation issuance index
+// so that it can later be revoked by key ID or by the user it was issued to. As with auditLog,
+// failing to record an issuance is logged rather than surfaced as a command failure.
+func recordIssuance(conf config.Config, keyID, principals, expiration, pubkeyFingerprint string) {
+	kbUser, err := currentOSUsername()
+	if err != nil {
+		kbUser = "unknown"
+	}
+	err = revocation.RecordIssuance(conf, revocation.IssuanceRecord{
+		KeyID:             keyID,
+		KBUser:            kbUser,
+		Team:              principals,
+		Expiration:        expiration,
+		PubkeyFingerprint: pubkeyFingerprint,
+	})
+	if err != nil {
+		logrus.Warnf("Failed to record issuance of %s in the revocation index: %v", keyID, err)
+	}
+}
+
+// currentOSUsername returns the name of the local OS user running the command, used to template
+// `{kb_user}` in a profile's principals/key ID when signing outside of the bot (which otherwise
+// gets a Keybase username from chat).
+func currentOSUsername() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+// The action for the `keybaseca sign-host` subcommand
+func signHostAction(c *cli.Context) error {
+	conf := config.EnvConfig{}
+	err := config.ValidateConfig(conf, true)
+	if err != nil {
+		return fmt.Errorf("Invalid config: %v", err)
+	}
 
-	// Read the public key from the specified file
 	filename := c.String("public-key")
 	pubKey, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("Failed to read file at %s to get the public key: %v", filename, err)
+		return fmt.Errorf("Failed to read file at %s to get the host public key: %v", filename, err)
 	}
+	hostnames := strings.Split(c.String("hostnames"), ",")
 
-	// Sign the public key
-	signature, err := sshutils.SignKey(conf.GetCAKeyLocation(), randomUUID.String()+":keybaseca-sign", principals, expiration, string(pubKey))
+	randomUUID, err := uuid.NewRandom()
 	if err != nil {
-		return fmt.Errorf("Failed to sign key: %v", err)
+		return fmt.Errorf("Failed to generate unique key ID: %v", err)
+	}
+	signer, err := loadConfiguredCASigner(&conf)
+	if err != nil {
+		return fmt.Errorf("Failed to load the configured CA key: %v", err)
+	}
+	signature, err := sshutils.SignHostKey(signer, randomUUID.String()+":keybaseca-sign-host",
+		hostnames, conf.GetKeyExpiration(), string(pubKey))
+	if err != nil {
+		return fmt.Errorf("Failed to sign host key: %v", err)
 	}
 
-	// Either store it in a file or print it to stdout
 	certPath := shared.KeyPathToCert(shared.PubKeyPathToKeyPath(filename))
 	_, err = os.Stat(certPath)
 	if os.IsNotExist(err) || c.Bool("overwrite") {
 		err = ioutil.WriteFile(certPath, []byte(signature), 0600)
 		if err != nil {
-			return fmt.Errorf("Failed to write certificate to file: %v", err)
+			return fmt.Errorf("Failed to write host certificate to file: %v", err)
 		}
-		fmt.Printf("Provisioned new certificate in %s\n", certPath)
+		fmt.Printf("Provisioned new host certificate in %s\n", certPath)
 	} else {
-		fmt.Printf("Provisioned new certificate. Place this in %s in order to use it with ssh.\n", certPath)
+		fmt.Printf("Provisioned new host certificate. Place this in %s in order to use it with sshd.\n", certPath)
 		fmt.Printf("\n```\n%s```\n", signature)
 	}
 	return nil
 }
 
+// The action for the `keybaseca provision-host` subcommand. It signs the given host key and
+// installs the resulting certificate, plus a TrustedUserCAKeys file pointing at the current user
+// CA public key, under the given sshd directory, so that a freshly imaged machine becomes both a
+// trusted host (sign-host) and a server that trusts certificates from this CA (TrustedUserCAKeys)
+// in one step. This is an operator-side convenience: it requires loadServerConfig's direct access
+// to the CA's own credentials, so it's meant to be run by whoever already operates the CA (eg
+// baked into a host's provisioning image alongside the CA key itself). A machine that only has
+// Keybase team membership -- not CA server access -- uses `kssh request-host-cert` instead, which
+// does the equivalent install over the gated chat flow.
+func provisionHostAction(c *cli.Context) error {
+	conf, err := loadServerConfig()
+	if err != nil {
+		return err
+	}
+
+	filename := c.String("public-key")
+	pubKey, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to read file at %s to get the host public key: %v", filename, err)
+	}
+	hostnames := strings.Split(c.String("hostnames"), ",")
+
+	randomUUID, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("Failed to generate unique key ID: %v", err)
+	}
+	signer, err := loadConfiguredCASigner(conf)
+	if err != nil {
+		return fmt.Errorf("Failed to load the configured CA key: %v", err)
+	}
+	signature, err := sshutils.SignHostKey(signer, randomUUID.String()+":keybaseca-provision-host",
+		hostnames, conf.GetKeyExpiration(), string(pubKey))
+	if err != nil {
+		return fmt.Errorf("Failed to sign host key: %v", err)
+	}
+
+	sshdDir := c.String("sshd-dir")
+	certPath := filepath.Join(sshdDir, filepath.Base(shared.KeyPathToCert(shared.PubKeyPathToKeyPath(filename))))
+	err = ioutil.WriteFile(certPath, []byte(signature), 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to install host certificate at %s: %v", certPath, err)
+	}
+
+	userCAPub, err := ioutil.ReadFile(conf.GetCAKeyLocation() + ".pub")
+	if err != nil {
+		return fmt.Errorf("Failed to read user CA public key: %v", err)
+	}
+	trustedUserCAKeysPath := filepath.Join(sshdDir, shared.TrustedUserCAKeysFilename)
+	err = ioutil.WriteFile(trustedUserCAKeysPath, userCAPub, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write TrustedUserCAKeys file at %s: %v", trustedUserCAKeysPath, err)
+	}
+
+	fmt.Printf("Installed host certificate at %s and TrustedUserCAKeys file at %s.\n", certPath, trustedUserCAKeysPath)
+	fmt.Printf("Add the following to sshd_config:\n\n  HostCertificate %s\n  TrustedUserCAKeys %s\n", certPath, trustedUserCAKeysPath)
+	return nil
+}
+
 // A global before action that handles the --debug flag by setting the logrus logging level
 func beforeAction(c *cli.Context) error {
 	if c.GlobalBool("debug") {
@@ -0,0 +1,64 @@
+// kssh-krl-fetch is a small helper intended to run as sshd's RevokedKeys refresher via a cron job
+// or systemd timer. It fetches the CA's current KRL from KBFS and writes it to a local path,
+// skipping the write if the revocation serial hasn't advanced since the last fetch.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/constants"
+	"github.com/keybase/bot-sshca/src/keybaseca/revocation"
+)
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintf(os.Stderr, "Usage: %s <team> <local-krl-path> <local-serial-path>\n", os.Args[0])
+		os.Exit(1)
+	}
+	team, localKRLPath, localSerialPath := os.Args[1], os.Args[2], os.Args[3]
+
+	err := fetch(team, localKRLPath, localSerialPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kssh-krl-fetch: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func fetch(team, localKRLPath, localSerialPath string) error {
+	remoteSerialPath := filepath.Join("/keybase/team/", team, revocation.SerialFilename)
+	remoteSerial, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(remoteSerialPath)
+	if err != nil {
+		return fmt.Errorf("failed to read revocation serial from KBFS: %v", err)
+	}
+	remoteSerial = strings.TrimSpace(remoteSerial)
+
+	localSerial := ""
+	if bytes, err := ioutil.ReadFile(localSerialPath); err == nil {
+		localSerial = strings.TrimSpace(string(bytes))
+	}
+	if remoteSerial == localSerial {
+		// Already up to date; nothing to refresh.
+		return nil
+	}
+
+	remoteKRLPath := filepath.Join("/keybase/team/", team, revocation.KRLFilename)
+	krlContent, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(remoteKRLPath)
+	if err != nil {
+		return fmt.Errorf("failed to read KRL from KBFS: %v", err)
+	}
+
+	err = ioutil.WriteFile(localKRLPath, []byte(krlContent), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write KRL to %s: %v", localKRLPath, err)
+	}
+	err = ioutil.WriteFile(localSerialPath, []byte(remoteSerial), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write revocation serial to %s: %v", localSerialPath, err)
+	}
+	fmt.Printf("Updated %s to revocation serial %s\n", localKRLPath, remoteSerial)
+	return nil
+}
@@ -0,0 +1,312 @@
+// kssh is the client side of keybaseca: it asks a CA bot over Keybase chat to sign a public key,
+// the same way `ssh-keygen`'s own `-s` flag would if you ran it against a CA you held the private
+// key for, without ever handing the CA key itself to the client.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/sshutils"
+	"github.com/keybase/bot-sshca/src/kssh"
+	"github.com/keybase/bot-sshca/src/shared"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/urfave/cli"
+)
+
+// The supported values for --output-mode, mirroring `keybaseca sign`'s flag of the same name.
+const (
+	outputModeFile         = "file"
+	outputModeAgent        = "agent"
+	outputModeStdoutBundle = "stdout-bundle"
+)
+
+var VersionNumber = "master"
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "kssh"
+	app.Usage = "Request a certificate from a keybaseca CA over Keybase chat"
+	app.Version = VersionNumber
+	app.ArgsUsage = "<public-key> (required only for --output-mode=file)"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "team",
+			Usage: "The Keybase team the CA bot lives in; skips auto-discovery if set",
+		},
+		cli.StringFlag{
+			Name:  "output-mode",
+			Value: outputModeFile,
+			Usage: "Where to deliver the signed certificate: `file` (write next to the public key), " +
+				"`agent` (load cert+key into SSH_AUTH_SOCK, no disk writes), or `stdout-bundle` " +
+				"(print a self-contained identity bundle as JSON; the JSON itself is not a key file " +
+				"that `ssh -i` reads)",
+		},
+		cli.StringFlag{
+			Name:  "profile",
+			Usage: "Name of a CA-configured profile to request, instead of the default unrestricted certificate",
+		},
+		cli.BoolFlag{
+			Name:  "overwrite",
+			Usage: "Overwrite the existing certificate on the filesystem",
+		},
+	}
+	app.Action = signAction
+	app.Commands = []cli.Command{
+		{
+			Name:      "request-host-cert",
+			Usage:     "Request a host certificate for this machine",
+			ArgsUsage: "<host-public-key>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "team",
+					Usage: "The Keybase team the CA bot lives in; skips auto-discovery if set",
+				},
+				cli.StringFlag{
+					Name:     "hostnames",
+					Usage:    "Comma separated DNS names to request as the certificate's valid principals",
+					Required: true,
+				},
+				cli.BoolFlag{
+					Name:  "overwrite",
+					Usage: "Overwrite the existing certificate on the filesystem",
+				},
+				cli.StringFlag{
+					Name: "sshd-dir",
+					Usage: "If set, also install a TrustedUserCAKeys file under this sshd directory (in " +
+						"addition to the host certificate), completing the same setup `keybaseca " +
+						"provision-host` does on the CA host -- for a fresh machine that only has " +
+						"Keybase team membership, not CA server access",
+				},
+			},
+			Action: requestHostCertAction,
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// signAction is the default action. With --output-mode=file (the default) it requests a user
+// certificate for the public key named as the lone argument and writes it to disk next to that
+// key. With --output-mode=agent or --output-mode=stdout-bundle, no disk-backed key is involved at
+// all: it generates an ephemeral keypair itself, requests a certificate for that over chat, and
+// delivers the key+cert as an IdentityBundle -- the same on-disk-free flow `keybaseca sign
+// --output-mode=agent/stdout-bundle` uses on the CA host, just driven by the chat request instead
+// of direct CA key access.
+func signAction(c *cli.Context) error {
+	outputMode := c.String("output-mode")
+	if outputMode != outputModeFile && outputMode != outputModeAgent && outputMode != outputModeStdoutBundle {
+		return fmt.Errorf("unsupported --output-mode %q, expected one of file/agent/stdout-bundle", outputMode)
+	}
+
+	cfg, err := loadConfig(c.String("team"))
+	if err != nil {
+		return err
+	}
+
+	if outputMode != outputModeFile {
+		return signEphemeral(c, cfg, outputMode)
+	}
+
+	filename := c.Args().First()
+	if filename == "" {
+		return fmt.Errorf("usage: kssh [flags] <public-key>")
+	}
+	pubKeyBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read public key at %s: %v", filename, err)
+	}
+	pubKey := strings.TrimSpace(string(pubKeyBytes))
+
+	signature, err := kssh.RequestCertificate(cfg, signCommand(c, pubKey))
+	if err != nil {
+		return fmt.Errorf("failed to get a certificate signed: %v", err)
+	}
+	warnIfRevocationsPublished(cfg.TeamName)
+
+	certPath := shared.KeyPathToCert(shared.PubKeyPathToKeyPath(filename))
+	return writeCert(certPath, signature, c.Bool("overwrite"))
+}
+
+// signEphemeral implements --output-mode=agent and --output-mode=stdout-bundle: it generates an
+// ephemeral keypair client-side (so the private key never touches disk), requests a certificate
+// for it over chat, and delivers the resulting IdentityBundle per outputMode.
+func signEphemeral(c *cli.Context, cfg kssh.ConfigFile, outputMode string) error {
+	privateKeyPEM, authorizedKey, err := sshutils.GenerateEphemeralKeypair()
+	if err != nil {
+		return fmt.Errorf("failed to generate ephemeral keypair: %v", err)
+	}
+
+	signature, err := kssh.RequestCertificate(cfg, signCommand(c, authorizedKey))
+	if err != nil {
+		return fmt.Errorf("failed to get a certificate signed: %v", err)
+	}
+	warnIfRevocationsPublished(cfg.TeamName)
+
+	bundle := sshutils.IdentityBundle{PrivateKeyPEM: privateKeyPEM, CertificatePEM: signature}
+	if caKeys, found, err := loadTrustedCAKeys(cfg.TeamName); err != nil {
+		return err
+	} else if found {
+		bundle.CAPublicKeys = caKeys
+	}
+
+	switch outputMode {
+	case outputModeAgent:
+		lifetime, err := certificateLifetime(signature)
+		if err != nil {
+			return fmt.Errorf("failed to determine certificate lifetime: %v", err)
+		}
+		if err := sshutils.LoadIntoAgent(bundle, lifetime); err != nil {
+			return fmt.Errorf("failed to load certificate into ssh-agent: %v", err)
+		}
+		fmt.Println("Loaded certificate into ssh-agent; it will expire from the agent automatically.")
+	case outputModeStdoutBundle:
+		bytes, err := bundle.MarshalBundle()
+		if err != nil {
+			return fmt.Errorf("failed to marshal identity bundle: %v", err)
+		}
+		fmt.Println(string(bytes))
+	}
+	return nil
+}
+
+// certificateLifetime returns how long until signature (an OpenSSH certificate in authorized_keys
+// format) expires, so the ssh-agent entry can be given a matching lifetime. Unlike `keybaseca
+// sign`, kssh has no local copy of the CA's configured expiration to consult -- the signed
+// certificate's own ValidBefore is the only source of truth available to the client.
+func certificateLifetime(signature string) (time.Duration, error) {
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(signature))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse issued certificate: %v", err)
+	}
+	cert, ok := parsed.(*ssh.Certificate)
+	if !ok {
+		return 0, fmt.Errorf("expected an ssh certificate, got %T", parsed)
+	}
+	return time.Until(time.Unix(int64(cert.ValidBefore), 0)), nil
+}
+
+// signCommand builds the chat command to request a certificate for pubKey, honoring --profile if set.
+func signCommand(c *cli.Context, pubKey string) string {
+	if profileName := c.String("profile"); profileName != "" {
+		return fmt.Sprintf("!ssh sign-profile %s %s", profileName, pubKey)
+	}
+	return "!ssh sign " + pubKey
+}
+
+// requestHostCertAction requests a host certificate over chat and installs it next to the given
+// host public key. With --sshd-dir set, it also installs a TrustedUserCAKeys file there from the
+// CA's published trust bundle, so a fresh machine -- authenticated as a member of the CA's hosts
+// team, with no CA server access at all -- can fully provision itself via this one command,
+// mirroring what `keybaseca provision-host` does on the CA host.
+func requestHostCertAction(c *cli.Context) error {
+	filename := c.Args().First()
+	if filename == "" {
+		return fmt.Errorf("usage: kssh request-host-cert [flags] <host-public-key>")
+	}
+	cfg, err := loadConfig(c.String("team"))
+	if err != nil {
+		return err
+	}
+
+	pubKeyBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read host public key at %s: %v", filename, err)
+	}
+	pubKey := strings.TrimSpace(string(pubKeyBytes))
+
+	command := fmt.Sprintf("!ssh sign-host %s %s", c.String("hostnames"), pubKey)
+	signature, err := kssh.RequestCertificate(cfg, command)
+	if err != nil {
+		return fmt.Errorf("failed to get a host certificate signed: %v", err)
+	}
+
+	certPath := shared.KeyPathToCert(shared.PubKeyPathToKeyPath(filename))
+	if err := writeCert(certPath, signature, c.Bool("overwrite")); err != nil {
+		return err
+	}
+
+	sshdDir := c.String("sshd-dir")
+	if sshdDir == "" {
+		return nil
+	}
+	caKeys, found, err := loadTrustedCAKeys(cfg.TeamName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no CA trust bundle has been published for %s yet (the CA must rotate at "+
+			"least once to publish one); install TrustedUserCAKeys manually for now", cfg.TeamName)
+	}
+	trustedUserCAKeysPath := filepath.Join(sshdDir, shared.TrustedUserCAKeysFilename)
+	content := strings.Join(caKeys, "\n") + "\n"
+	if err := ioutil.WriteFile(trustedUserCAKeysPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write TrustedUserCAKeys file at %s: %v", trustedUserCAKeysPath, err)
+	}
+	fmt.Printf("Installed TrustedUserCAKeys file at %s.\n", trustedUserCAKeysPath)
+	fmt.Printf("Add the following to sshd_config:\n\n  HostCertificate %s\n  TrustedUserCAKeys %s\n",
+		certPath, trustedUserCAKeysPath)
+	return nil
+}
+
+func loadConfig(team string) (kssh.ConfigFile, error) {
+	if team != "" {
+		return kssh.LoadConfig(team)
+	}
+	return kssh.DiscoverConfig()
+}
+
+// warnIfRevocationsPublished lets a kssh user know that team's CA has revoked at least one
+// certificate, so a newly issued cert could still be rejected by a server whose sshd hasn't yet
+// picked up the current KRL via kssh-krl-fetch. It only logs a warning; a failure here shouldn't
+// fail the cert request that already succeeded.
+func warnIfRevocationsPublished(team string) {
+	serial, _, _, err := kssh.RevocationStatus(team, 0)
+	if err != nil || serial == 0 {
+		return
+	}
+	fmt.Printf("Note: this CA has revoked certificates before (revocation serial %d); "+
+		"if a server rejects this cert, its sshd may not have refreshed its RevokedKeys yet.\n", serial)
+}
+
+// loadTrustedCAKeys returns the CA public keys published for team, if the CA has ever rotated (see
+// rotation.Rotate) and thus published a trust bundle. If it hasn't, found is false: nothing is
+// published yet to reconcile against, so the caller falls back to whatever trust it already has.
+func loadTrustedCAKeys(team string) (keys []string, found bool, err error) {
+	if manifest, rotated, err := kssh.RotationStatus(team); err != nil {
+		return nil, false, fmt.Errorf("failed to check CA rotation status: %v", err)
+	} else if rotated && !manifest.OldKeyRemoved {
+		fmt.Printf("CA key last rotated at %s; still trusting both old and new keys until %s\n",
+			manifest.RotatedAt.Format(time.RFC3339), manifest.GraceDeadline.Format(time.RFC3339))
+	}
+
+	keys, found, err = kssh.TrustedCAKeys(team)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load trusted CA keys: %v", err)
+	}
+	return keys, found, nil
+}
+
+// writeCert writes signature to certPath, refusing to clobber an existing certificate unless
+// overwrite is set, matching `keybaseca sign`'s own behavior.
+func writeCert(certPath, signature string, overwrite bool) error {
+	if _, err := ioutil.ReadFile(certPath); err == nil && !overwrite {
+		return fmt.Errorf("%s already exists; pass --overwrite to replace it", certPath)
+	}
+	err := ioutil.WriteFile(certPath, []byte(signature), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write certificate to %s: %v", certPath, err)
+	}
+	fmt.Printf("Provisioned new certificate in %s\n", certPath)
+	return nil
+}
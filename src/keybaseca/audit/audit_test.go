@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/casigner"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testSigner(t *testing.T) casigner.CASigner {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("failed to marshal test key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "ca")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write test key: %v", err)
+	}
+	signer, err := casigner.NewFileSigner(keyPath)
+	if err != nil {
+		t.Fatalf("failed to load test signer: %v", err)
+	}
+	return signer
+}
+
+func TestAppendAndVerifyRoundTrip(t *testing.T) {
+	signer := testSigner(t)
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	logger := NewLogger(logPath, signer)
+
+	if err := logger.Append("alice", "sign", "uuid-1:keybaseca-sign", "acme.prod", "24h", "SHA256:abc"); err != nil {
+		t.Fatalf("failed to append first record: %v", err)
+	}
+	if err := logger.Append("bob", "sign", "uuid-2:keybaseca-sign", "acme.prod", "24h", "SHA256:def"); err != nil {
+		t.Fatalf("failed to append second record: %v", err)
+	}
+
+	records, err := Verify(logPath, signer.Public())
+	if err != nil {
+		t.Fatalf("expected an untampered log to verify cleanly, got: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if records[0].Seq != 0 || records[1].Seq != 1 {
+		t.Fatalf("unexpected sequence numbers: %d, %d", records[0].Seq, records[1].Seq)
+	}
+	if records[1].PrevHash == "" {
+		t.Fatal("expected the second record to chain to the first via a non-empty prev_hash")
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	signer := testSigner(t)
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	logger := NewLogger(logPath, signer)
+
+	if err := logger.Append("alice", "sign", "uuid-1:keybaseca-sign", "acme.prod", "24h", "SHA256:abc"); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+	if err := logger.Append("alice", "sign", "uuid-2:keybaseca-sign", "acme.prod", "24h", "SHA256:def"); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	tampered := strings.Replace(string(content), "alice", "mallory", 1)
+	if err := os.WriteFile(logPath, []byte(tampered), 0600); err != nil {
+		t.Fatalf("failed to write tampered log: %v", err)
+	}
+
+	if _, err := Verify(logPath, signer.Public()); err == nil {
+		t.Fatal("expected Verify to detect tampering with a record's signed contents")
+	}
+}
+
+func TestVerifyDetectsWrongCAKey(t *testing.T) {
+	signer := testSigner(t)
+	otherSigner := testSigner(t)
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	logger := NewLogger(logPath, signer)
+
+	if err := logger.Append("alice", "sign", "uuid-1:keybaseca-sign", "acme.prod", "24h", "SHA256:abc"); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+
+	if _, err := Verify(logPath, otherSigner.Public()); err == nil {
+		t.Fatal("expected Verify to fail when checking against the wrong CA public key")
+	}
+}
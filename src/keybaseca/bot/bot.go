@@ -0,0 +1,319 @@
+// Package bot implements the `keybaseca service` chatbot: it listens for `!ssh sign`, `!ssh
+// sign-profile`, and `!ssh sign-host` requests in the configured Keybase teams and replies with a
+// signed certificate.
+package bot
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/audit"
+	"github.com/keybase/bot-sshca/src/keybaseca/casigner"
+	"github.com/keybase/bot-sshca/src/keybaseca/config"
+	"github.com/keybase/bot-sshca/src/keybaseca/profiles"
+	"github.com/keybase/bot-sshca/src/keybaseca/revocation"
+	"github.com/keybase/bot-sshca/src/keybaseca/sshutils"
+
+	"github.com/keybase/go-keybase-chat-bot/kbchat"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// signCommand is the chat command users send to request a certificate with every permission
+// GetTeams() grants, eg `!ssh sign <pubkey>`.
+const signCommand = "!ssh sign"
+
+// signProfileCommand is the chat command users send to request a certificate bounded by a named
+// profile, eg `!ssh sign-profile <profile> <pubkey>`. Unlike the `--profile` flag on `keybaseca
+// sign`, this path has a real requesting user behind it, so the profile's allowed teams are
+// checked against that user's actual Keybase team memberships.
+const signProfileCommand = "!ssh sign-profile"
+
+// signHostCommand is the chat command a host sends to request a host certificate, eg `!ssh
+// sign-host <hostname1,hostname2> <host-pubkey>`. This is what `kssh request-host-cert` talks to.
+// Minting a host certificate is a stronger grant than an unrestricted user cert -- every client
+// ends up trusting the named hostname -- so it's gated by membership in one of
+// conf.GetHostsTeams(), a narrower allowlist than the GetTeams() that signCommand checks.
+const signHostCommand = "!ssh sign-host"
+
+// GetUsername returns the Keybase username of the bot account running this CA.
+func GetUsername(conf config.Config) (string, error) {
+	api, err := kbchat.Start(kbchat.RunOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to start the Keybase chat API: %v", err)
+	}
+	defer api.Shutdown()
+	username := api.GetUsername()
+	if username == "" {
+		return "", fmt.Errorf("failed to determine the bot's Keybase username; is `keybase` logged in?")
+	}
+	return username, nil
+}
+
+// StartBot runs the CA chatbot until it is shut down: it listens for sign requests in every team
+// conf is configured for and replies to each with a signed certificate, or an error message if
+// signing failed.
+func StartBot(conf config.Config) error {
+	var available []profiles.Profile
+	if path := conf.GetProfilesConfigPath(); path != "" {
+		loaded, err := profiles.LoadProfiles(path)
+		if err != nil {
+			return fmt.Errorf("failed to load profiles: %v", err)
+		}
+		available = loaded
+	}
+
+	signer, err := casigner.Load(currentCABackend(), currentCABackendLocation(conf))
+	if err != nil {
+		return fmt.Errorf("failed to load the configured CA key: %v", err)
+	}
+
+	api, err := kbchat.Start(kbchat.RunOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start the Keybase chat API: %v", err)
+	}
+	defer api.Shutdown()
+
+	sub, err := api.ListenForNewTextMessages()
+	if err != nil {
+		return fmt.Errorf("failed to listen for chat messages: %v", err)
+	}
+
+	for {
+		msg, err := sub.Read()
+		if err != nil {
+			return fmt.Errorf("failed to read a chat message: %v", err)
+		}
+		if msg.Message.Content.Text == nil {
+			continue
+		}
+		body := strings.TrimSpace(msg.Message.Content.Text.Body)
+		kbUser := msg.Message.Sender.Username
+
+		// Requests are only served from the configured chat team (and channel, if set) or, with no
+		// chat team configured, from a conversation in one of GetTeams().
+		channel := msg.Message.Channel
+		if chatTeam := conf.GetChatTeam(); chatTeam != "" {
+			if channel.Name != chatTeam || (conf.GetChannelName() != "" && channel.TopicName != conf.GetChannelName()) {
+				continue
+			}
+		} else if !intersects(conf.GetTeams(), []string{channel.Name}) {
+			continue
+		}
+
+		var reply string
+		switch {
+		case strings.HasPrefix(body, signHostCommand):
+			args := strings.TrimSpace(strings.TrimPrefix(body, signHostCommand))
+			hostnames, hostPubKey, ok := splitFirstArg(args)
+			if !ok {
+				reply = fmt.Sprintf("usage: %s <hostname1,hostname2,...> <host-public-key>", signHostCommand)
+				break
+			}
+			reply, err = handleSignHostRequest(conf, signer, api, kbUser, hostnames, hostPubKey)
+			if err != nil {
+				reply = fmt.Sprintf("Failed to sign: %v", err)
+				logrus.Warnf("host sign request from %s failed: %v", kbUser, err)
+			}
+		case strings.HasPrefix(body, signProfileCommand):
+			args := strings.TrimSpace(strings.TrimPrefix(body, signProfileCommand))
+			profileName, pubKey, ok := splitFirstArg(args)
+			if !ok {
+				reply = fmt.Sprintf("usage: %s <profile> <public-key>", signProfileCommand)
+				break
+			}
+			reply, err = handleSignProfileRequest(conf, signer, api, available, kbUser, profileName, pubKey)
+			if err != nil {
+				reply = fmt.Sprintf("Failed to sign: %v", err)
+				logrus.Warnf("profile sign request from %s failed: %v", kbUser, err)
+			}
+		case strings.HasPrefix(body, signCommand):
+			pubKey := strings.TrimSpace(strings.TrimPrefix(body, signCommand))
+			reply, err = handleSignRequest(conf, signer, kbUser, pubKey)
+			if err != nil {
+				reply = fmt.Sprintf("Failed to sign: %v", err)
+				logrus.Warnf("sign request from %s failed: %v", kbUser, err)
+			}
+		default:
+			continue
+		}
+
+		if _, sendErr := api.SendMessage(msg.Message.Channel, "%s", reply); sendErr != nil {
+			logrus.Warnf("failed to reply to %s: %v", kbUser, sendErr)
+		}
+	}
+}
+
+// handleSignRequest signs a certificate for a single `!ssh sign` chat message. kbUser is the
+// Keybase username that sent it. signer is whichever CA key backend is currently configured.
+func handleSignRequest(conf config.Config, signer casigner.CASigner, kbUser, pubKey string) (string, error) {
+	if pubKey == "" {
+		return "", fmt.Errorf("usage: %s <public-key>", signCommand)
+	}
+
+	principals := strings.Join(conf.GetTeams(), ",")
+	expiration := conf.GetKeyExpiration()
+	randomUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate a unique key ID: %v", err)
+	}
+	keyID := randomUUID.String() + ":keybaseca-sign"
+
+	signature, err := sshutils.SignKey(signer, keyID, principals, expiration, pubKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign key: %v", err)
+	}
+
+	if fingerprint, fpErr := sshutils.FingerprintPublicKey(pubKey); fpErr == nil {
+		if auditErr := audit.NewLogger(conf.GetLogLocation()+".audit", signer).
+			Append(kbUser, "sign", keyID, principals, expiration, fingerprint); auditErr != nil {
+			logrus.Warnf("failed to append audit log record for sign: %v", auditErr)
+		}
+		if issuanceErr := revocation.RecordIssuance(conf, revocation.IssuanceRecord{
+			KeyID: keyID, KBUser: kbUser, Team: principals, Expiration: expiration, PubkeyFingerprint: fingerprint,
+		}); issuanceErr != nil {
+			logrus.Warnf("failed to record issuance of %s in the revocation index: %v", keyID, issuanceErr)
+		}
+	}
+
+	return signature, nil
+}
+
+// splitFirstArg splits a two-argument chat command body into its first argument and the rest, eg
+// "prod-readers ssh-ed25519 AAAA..." -> ("prod-readers", "ssh-ed25519 AAAA...").
+func splitFirstArg(args string) (first, rest string, ok bool) {
+	first, rest, ok = strings.Cut(args, " ")
+	if !ok {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if first == "" || rest == "" {
+		return "", "", false
+	}
+	return first, rest, true
+}
+
+// handleSignProfileRequest signs a certificate for a single `!ssh sign-profile` chat message,
+// bounded by the named profile. Unlike the CLI's `--profile` flag, kbUser here is a real Keybase
+// identity, so the profile's allowed teams are checked against kbUser's actual team memberships
+// (via api.ListUserMemberships) rather than trusted on the requester's say-so.
+func handleSignProfileRequest(conf config.Config, signer casigner.CASigner, api *kbchat.API, available []profiles.Profile, kbUser, profileName, pubKey string) (string, error) {
+	if len(available) == 0 {
+		return "", fmt.Errorf("no profiles are configured; set PROFILES_CONFIG to enable %s", signProfileCommand)
+	}
+
+	memberships, err := api.ListUserMemberships(kbUser)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s's team memberships: %v", kbUser, err)
+	}
+	userTeams := make([]string, len(memberships))
+	for i, membership := range memberships {
+		userTeams[i] = membership.FqName
+	}
+
+	selected, err := profiles.Select(available, profileName, userTeams)
+	if err != nil {
+		return "", err
+	}
+
+	principals := selected.RenderPrincipals(kbUser)
+	expiration := selected.Validity
+	if expiration == "" {
+		expiration = conf.GetKeyExpiration()
+	}
+	keyID := selected.RenderKeyID(kbUser)
+
+	signature, err := sshutils.SignKeyWithProfile(signer, keyID, principals, expiration, pubKey,
+		selected.Extensions, selected.CriticalOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign key: %v", err)
+	}
+
+	if fingerprint, fpErr := sshutils.FingerprintPublicKey(pubKey); fpErr == nil {
+		if auditErr := audit.NewLogger(conf.GetLogLocation()+".audit", signer).
+			Append(kbUser, "sign-profile:"+selected.Name, keyID, principals, expiration, fingerprint); auditErr != nil {
+			logrus.Warnf("failed to append audit log record for sign-profile: %v", auditErr)
+		}
+		if issuanceErr := revocation.RecordIssuance(conf, revocation.IssuanceRecord{
+			KeyID: keyID, KBUser: kbUser, Team: principals, Expiration: expiration, PubkeyFingerprint: fingerprint,
+		}); issuanceErr != nil {
+			logrus.Warnf("failed to record issuance of %s in the revocation index: %v", keyID, issuanceErr)
+		}
+	}
+
+	return signature, nil
+}
+
+// handleSignHostRequest signs a host certificate for a single `!ssh sign-host` chat message.
+// hostnames is a comma separated list of the host's DNS names, used as the certificate's valid
+// principals. Minting a host certificate is a stronger grant than an ordinary user cert -- it
+// makes every client trust the named hostname -- so kbUser must belong to one of
+// conf.GetHostsTeams() rather than just GetTeams().
+func handleSignHostRequest(conf config.Config, signer casigner.CASigner, api *kbchat.API, kbUser, hostnames, hostPubKey string) (string, error) {
+	hostsTeams := conf.GetHostsTeams()
+	if len(hostsTeams) == 0 {
+		return "", fmt.Errorf("no hosts team is configured; set HOSTS_TEAMS to enable %s", signHostCommand)
+	}
+	memberships, err := api.ListUserMemberships(kbUser)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s's team memberships: %v", kbUser, err)
+	}
+	userTeams := make([]string, len(memberships))
+	for i, membership := range memberships {
+		userTeams[i] = membership.FqName
+	}
+	if !intersects(hostsTeams, userTeams) {
+		return "", fmt.Errorf("%s is not a member of a team allowed to request host certificates", kbUser)
+	}
+
+	expiration := conf.GetKeyExpiration()
+	randomUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate a unique key ID: %v", err)
+	}
+	keyID := randomUUID.String() + ":keybaseca-sign-host"
+
+	signature, err := sshutils.SignHostKey(signer, keyID, strings.Split(hostnames, ","), expiration, hostPubKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign host key: %v", err)
+	}
+
+	if fingerprint, fpErr := sshutils.FingerprintPublicKey(hostPubKey); fpErr == nil {
+		if auditErr := audit.NewLogger(conf.GetLogLocation()+".audit", signer).
+			Append(kbUser, "sign-host", keyID, hostnames, expiration, fingerprint); auditErr != nil {
+			logrus.Warnf("failed to append audit log record for sign-host: %v", auditErr)
+		}
+		if issuanceErr := revocation.RecordIssuance(conf, revocation.IssuanceRecord{
+			KeyID: keyID, KBUser: kbUser, Team: hostnames, Expiration: expiration, PubkeyFingerprint: fingerprint,
+		}); issuanceErr != nil {
+			logrus.Warnf("failed to record issuance of %s in the revocation index: %v", keyID, issuanceErr)
+		}
+	}
+
+	return signature, nil
+}
+
+// intersects reports whether a and b share at least one element.
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func currentCABackend() casigner.Backend {
+	return casigner.Backend(os.Getenv("CA_KEY_BACKEND"))
+}
+
+func currentCABackendLocation(conf config.Config) string {
+	if location := os.Getenv("CA_KEY_BACKEND_LOCATION"); location != "" {
+		return location
+	}
+	return conf.GetCAKeyLocation()
+}
@@ -0,0 +1,44 @@
+package bot
+
+import "testing"
+
+func TestSplitFirstArg(t *testing.T) {
+	first, rest, ok := splitFirstArg("prod-readers ssh-ed25519 AAAA... comment")
+	if !ok {
+		t.Fatal("expected ok=true for a well-formed two-argument command")
+	}
+	if first != "prod-readers" {
+		t.Fatalf("got first=%q, want %q", first, "prod-readers")
+	}
+	if rest != "ssh-ed25519 AAAA... comment" {
+		t.Fatalf("got rest=%q, want %q", rest, "ssh-ed25519 AAAA... comment")
+	}
+}
+
+func TestSplitFirstArgRejectsMissingSecondArg(t *testing.T) {
+	if _, _, ok := splitFirstArg("prod-readers"); ok {
+		t.Fatal("expected ok=false when there's no second argument")
+	}
+}
+
+func TestSplitFirstArgRejectsEmptyInput(t *testing.T) {
+	if _, _, ok := splitFirstArg(""); ok {
+		t.Fatal("expected ok=false for empty input")
+	}
+}
+
+func TestSplitFirstArgRejectsBlankFirstArg(t *testing.T) {
+	if _, _, ok := splitFirstArg(" ssh-ed25519 AAAA..."); ok {
+		t.Fatal("expected ok=false when the first argument is blank")
+	}
+}
+
+func TestSplitFirstArgTrimsTrailingWhitespace(t *testing.T) {
+	_, rest, ok := splitFirstArg("prod-readers ssh-ed25519 AAAA...  ")
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if rest != "ssh-ed25519 AAAA..." {
+		t.Fatalf("got rest=%q, want trailing whitespace trimmed", rest)
+	}
+}
@@ -0,0 +1,91 @@
+// Package casigner abstracts the CA's access to its own signing key behind a small interface so
+// that the key can live on disk, in a PKCS#11 token (YubiHSM, SoftHSM), or in a cloud KMS instead
+// of always being a PEM file that every command reads off the filesystem.
+package casigner
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CASigner is satisfied by anything that can hand back the CA's public key and use the
+// corresponding private key to sign a certificate, regardless of where that private key lives.
+type CASigner interface {
+	// Public returns the CA's public key.
+	Public() ssh.PublicKey
+	// SignCert signs cert in place, filling in its Signature field.
+	SignCert(cert *ssh.Certificate) error
+	// SignBytes signs an arbitrary payload, for callers (like the audit log) that need a CA
+	// signature over something other than a certificate.
+	SignBytes(data []byte) (*ssh.Signature, error)
+	// Exportable reports whether the private key backing this signer can be read back out, eg for
+	// `keybaseca backup`. File-backed signers are exportable; HSM and KMS backed ones are not.
+	Exportable() bool
+	// Export returns the raw private key material. Only valid to call when Exportable() is true;
+	// implementations that are not exportable return an error.
+	Export() ([]byte, error)
+}
+
+// Backend names the supported values of `keybaseca generate --backend=` and the CA_KEY_BACKEND
+// environment variable consulted by commands that need to load the currently configured signer.
+type Backend string
+
+const (
+	BackendFile    Backend = "file"
+	BackendPKCS11  Backend = "pkcs11"
+	BackendAWSKMS  Backend = "aws-kms"
+	BackendGCPKMS  Backend = "gcp-kms"
+)
+
+// Load returns the CASigner for the given backend, using the backend-specific parameters it
+// requires (a filesystem path for BackendFile, a PKCS#11 module/slot/label for BackendPKCS11, or a
+// key ID/name for the KMS backends).
+func Load(backend Backend, location string) (CASigner, error) {
+	switch backend {
+	case BackendFile, "":
+		return NewFileSigner(location)
+	case BackendPKCS11:
+		return NewPKCS11Signer(location)
+	case BackendAWSKMS:
+		return NewAWSKMSSigner(location)
+	case BackendGCPKMS:
+		return NewGCPKMSSigner(location)
+	default:
+		return nil, fmt.Errorf("unknown CA key backend %q", backend)
+	}
+}
+
+// Create provisions a brand new CA keypair in the given backend and returns the CASigner for it
+// along with the location string that should be passed to Load (and saved as
+// CA_KEY_BACKEND_LOCATION) on every later invocation. Unlike Load, this never reads back a key a
+// human already created out-of-band -- it is the backend-specific equivalent of `ssh-keygen`.
+//
+// location's meaning is backend-specific: for BackendPKCS11 it's the
+// "<module-path>#<slot>#<key-label>" the new keypair is generated under (the label is
+// operator-chosen, so the returned location is the same string); for BackendAWSKMS it's an
+// optional human-readable description and the returned location is the KMS-assigned key ID; for
+// BackendGCPKMS it's the key ring to create the key in and the returned location is the full
+// resource name of the new key's first version.
+func Create(backend Backend, location string) (signer CASigner, resultingLocation string, err error) {
+	switch backend {
+	case BackendFile, "":
+		return nil, "", fmt.Errorf("backend %q is provisioned via sshutils.Generate, not casigner.Create", BackendFile)
+	case BackendPKCS11:
+		signer, err = CreatePKCS11Signer(location)
+		return signer, location, err
+	case BackendAWSKMS:
+		return CreateAWSKMSSigner(location)
+	case BackendGCPKMS:
+		return CreateGCPKMSSigner(location)
+	default:
+		return nil, "", fmt.Errorf("unknown CA key backend %q", backend)
+	}
+}
+
+// signWithRand is shared by every backend's SignCert: ssh.Certificate.SignCert
+// needs an io.Reader for any randomness the signing operation requires.
+func signWithRand(cert *ssh.Certificate, signer ssh.Signer) error {
+	return cert.SignCert(rand.Reader, signer)
+}
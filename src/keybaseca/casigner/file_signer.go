@@ -0,0 +1,48 @@
+package casigner
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// FileSigner is the long-standing behavior: the CA private key is a PEM file on disk.
+type FileSigner struct {
+	location string
+	signer   ssh.Signer
+}
+
+// NewFileSigner loads the CA private key from a PEM file at location.
+func NewFileSigner(location string) (*FileSigner, error) {
+	bytes, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key at %s: %v", location, err)
+	}
+	signer, err := ssh.ParsePrivateKey(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key at %s: %v", location, err)
+	}
+	return &FileSigner{location: location, signer: signer}, nil
+}
+
+func (f *FileSigner) Public() ssh.PublicKey {
+	return f.signer.PublicKey()
+}
+
+func (f *FileSigner) SignCert(cert *ssh.Certificate) error {
+	return signWithRand(cert, f.signer)
+}
+
+func (f *FileSigner) SignBytes(data []byte) (*ssh.Signature, error) {
+	return f.signer.Sign(rand.Reader, data)
+}
+
+func (f *FileSigner) Exportable() bool {
+	return true
+}
+
+func (f *FileSigner) Export() ([]byte, error) {
+	return ioutil.ReadFile(f.location)
+}
@@ -0,0 +1,28 @@
+package casigner
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// parseDERPublicKey parses a DER-encoded SubjectPublicKeyInfo, the format AWS KMS's
+// GetPublicKey returns its PublicKey field in.
+func parseDERPublicKey(der []byte) (crypto.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DER public key: %v", err)
+	}
+	return pub, nil
+}
+
+// parsePEMPublicKey parses a PEM-encoded SubjectPublicKeyInfo, the format GCP KMS's
+// GetPublicKey returns its Pem field in.
+func parsePEMPublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM public key")
+	}
+	return parseDERPublicKey(block.Bytes)
+}
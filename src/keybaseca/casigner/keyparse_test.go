@@ -0,0 +1,67 @@
+package casigner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func testECPublicKey(t *testing.T) ([]byte, *ecdsa.PublicKey) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test EC key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal test EC key: %v", err)
+	}
+	return der, &priv.PublicKey
+}
+
+func TestParseDERPublicKey(t *testing.T) {
+	der, want := testECPublicKey(t)
+	got, err := parseDERPublicKey(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ecKey, ok := got.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("got %T, want *ecdsa.PublicKey", got)
+	}
+	if ecKey.X.Cmp(want.X) != 0 || ecKey.Y.Cmp(want.Y) != 0 {
+		t.Fatal("parsed EC point does not match the original key")
+	}
+}
+
+func TestParseDERPublicKeyRejectsGarbage(t *testing.T) {
+	if _, err := parseDERPublicKey([]byte("not a DER key")); err == nil {
+		t.Fatal("expected an error parsing garbage DER bytes")
+	}
+}
+
+func TestParsePEMPublicKey(t *testing.T) {
+	der, want := testECPublicKey(t)
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	got, err := parsePEMPublicKey(pemBytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ecKey, ok := got.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("got %T, want *ecdsa.PublicKey", got)
+	}
+	if ecKey.X.Cmp(want.X) != 0 || ecKey.Y.Cmp(want.Y) != 0 {
+		t.Fatal("parsed EC point does not match the original key")
+	}
+}
+
+func TestParsePEMPublicKeyRejectsNonPEM(t *testing.T) {
+	if _, err := parsePEMPublicKey([]byte("not PEM at all")); err == nil {
+		t.Fatal("expected an error parsing non-PEM bytes")
+	}
+}
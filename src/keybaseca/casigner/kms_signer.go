@@ -0,0 +1,228 @@
+package casigner
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	gcpkms "cloud.google.com/go/kms/apiv1"
+	gcpkmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+// kmsSigner is the shared plumbing between the AWS and GCP KMS backends: both sign with an
+// asymmetric key that never leaves the cloud provider's HSM-backed key store, so Exportable is
+// always false.
+type kmsSigner struct {
+	keyID  string
+	signer ssh.Signer
+}
+
+func (k *kmsSigner) Public() ssh.PublicKey {
+	return k.signer.PublicKey()
+}
+
+func (k *kmsSigner) SignCert(cert *ssh.Certificate) error {
+	return signWithRand(cert, k.signer)
+}
+
+func (k *kmsSigner) SignBytes(data []byte) (*ssh.Signature, error) {
+	return k.signer.Sign(rand.Reader, data)
+}
+
+func (k *kmsSigner) Exportable() bool {
+	return false
+}
+
+func (k *kmsSigner) Export() ([]byte, error) {
+	return nil, fmt.Errorf("CA key %s is held in a cloud KMS and cannot be exported", k.keyID)
+}
+
+// NewAWSKMSSigner returns a CASigner backed by an AWS KMS asymmetric signing key, identified by
+// its key ID or ARN.
+func NewAWSKMSSigner(keyID string) (CASigner, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	return loadAWSKMSSigner(kms.NewFromConfig(cfg), keyID)
+}
+
+// loadAWSKMSSigner fetches the public half of keyID from an already-constructed client and wraps
+// it as a CASigner. Shared by NewAWSKMSSigner (load an existing key) and CreateAWSKMSSigner (wrap
+// the key it just provisioned).
+func loadAWSKMSSigner(client *kms.Client, keyID string) (CASigner, error) {
+	pub, err := client.GetPublicKey(context.Background(), &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch AWS KMS public key for %s: %v", keyID, err)
+	}
+	cryptoSigner := &awsKMSCryptoSigner{client: client, keyID: keyID, publicKeyDER: pub.PublicKey}
+	pubKey, err := cryptoSigner.parsePublicKey()
+	if err != nil {
+		return nil, err
+	}
+	cryptoSigner.publicKey = pubKey
+
+	sshSigner, err := ssh.NewSignerFromSigner(cryptoSigner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap AWS KMS key %s as an ssh.Signer: %v", keyID, err)
+	}
+	return &kmsSigner{keyID: keyID, signer: sshSigner}, nil
+}
+
+// CreateAWSKMSSigner provisions a brand new ECC_NIST_P256 signing key in AWS KMS, optionally
+// described by description, and returns a signer for it plus the KMS-assigned key ID that should
+// be saved as the backend location for every later `keybaseca generate`/sign invocation.
+func CreateAWSKMSSigner(description string) (CASigner, string, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	client := kms.NewFromConfig(cfg)
+
+	input := &kms.CreateKeyInput{
+		KeySpec:  types.KeySpecEccNistP256,
+		KeyUsage: types.KeyUsageTypeSignVerify,
+	}
+	if description != "" {
+		input.Description = aws.String(description)
+	}
+	created, err := client.CreateKey(context.Background(), input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create AWS KMS key: %v", err)
+	}
+	keyID := aws.ToString(created.KeyMetadata.KeyId)
+
+	signer, err := loadAWSKMSSigner(client, keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	return signer, keyID, nil
+}
+
+type awsKMSCryptoSigner struct {
+	client       *kms.Client
+	keyID        string
+	publicKeyDER []byte
+	publicKey    crypto.PublicKey
+}
+
+func (s *awsKMSCryptoSigner) parsePublicKey() (crypto.PublicKey, error) {
+	return parseDERPublicKey(s.publicKeyDER)
+}
+
+func (s *awsKMSCryptoSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *awsKMSCryptoSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	out, err := s.client.Sign(context.Background(), &kms.SignInput{
+		KeyId:            aws.String(s.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("AWS KMS signing operation failed: %v", err)
+	}
+	return out.Signature, nil
+}
+
+// NewGCPKMSSigner returns a CASigner backed by a GCP Cloud KMS asymmetric signing key, identified
+// by its full resource name (projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*).
+func NewGCPKMSSigner(keyName string) (CASigner, error) {
+	client, err := gcpkms.NewKeyManagementClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP KMS client: %v", err)
+	}
+	return loadGCPKMSSigner(client, keyName)
+}
+
+// loadGCPKMSSigner fetches the public half of the crypto key version keyName from an
+// already-constructed client and wraps it as a CASigner. Shared by NewGCPKMSSigner (load an
+// existing key) and CreateGCPKMSSigner (wrap the key version it just provisioned).
+func loadGCPKMSSigner(client *gcpkms.KeyManagementClient, keyName string) (CASigner, error) {
+	pub, err := client.GetPublicKey(context.Background(), &gcpkmspb.GetPublicKeyRequest{Name: keyName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch GCP KMS public key for %s: %v", keyName, err)
+	}
+	cryptoSigner := &gcpKMSCryptoSigner{client: client, keyName: keyName}
+	pubKey, err := parsePEMPublicKey([]byte(pub.Pem))
+	if err != nil {
+		return nil, err
+	}
+	cryptoSigner.publicKey = pubKey
+
+	sshSigner, err := ssh.NewSignerFromSigner(cryptoSigner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap GCP KMS key %s as an ssh.Signer: %v", keyName, err)
+	}
+	return &kmsSigner{keyID: keyName, signer: sshSigner}, nil
+}
+
+// CreateGCPKMSSigner provisions a brand new EC_SIGN_P256_SHA256 asymmetric signing key in the
+// given key ring (keyRing is the full "projects/*/locations/*/keyRings/*" resource name) and
+// returns a signer for its first version plus that version's resource name, which should be saved
+// as the backend location for every later `keybaseca generate`/sign invocation.
+func CreateGCPKMSSigner(keyRing string) (CASigner, string, error) {
+	client, err := gcpkms.NewKeyManagementClient(context.Background())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create GCP KMS client: %v", err)
+	}
+
+	cryptoKeyID := fmt.Sprintf("keybaseca-%d", time.Now().UnixNano())
+	cryptoKey, err := client.CreateCryptoKey(context.Background(), &gcpkmspb.CreateCryptoKeyRequest{
+		Parent:      keyRing,
+		CryptoKeyId: cryptoKeyID,
+		CryptoKey: &gcpkmspb.CryptoKey{
+			Purpose: gcpkmspb.CryptoKey_ASYMMETRIC_SIGN,
+			VersionTemplate: &gcpkmspb.CryptoKeyVersionTemplate{
+				Algorithm: gcpkmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+			},
+		},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create GCP KMS key in %s: %v", keyRing, err)
+	}
+
+	// CreateCryptoKey with a VersionTemplate provisions its first version (version 1) immediately.
+	versionName := cryptoKey.Name + "/cryptoKeyVersions/1"
+	signer, err := loadGCPKMSSigner(client, versionName)
+	if err != nil {
+		return nil, "", err
+	}
+	return signer, versionName, nil
+}
+
+type gcpKMSCryptoSigner struct {
+	client    *gcpkms.KeyManagementClient
+	keyName   string
+	publicKey crypto.PublicKey
+}
+
+func (s *gcpKMSCryptoSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *gcpKMSCryptoSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	// digest is already the SHA256 digest of the cert bytes (that's the contract crypto.Signer.Sign
+	// documents, and what ssh.NewSignerFromSigner's caller relies on) -- hashing it again here would
+	// have KMS sign SHA256(SHA256(cert)) instead of SHA256(cert), which sshd would never verify.
+	resp, err := s.client.AsymmetricSign(context.Background(), &gcpkmspb.AsymmetricSignRequest{
+		Name:   s.keyName,
+		Digest: &gcpkmspb.Digest{Digest: &gcpkmspb.Digest_Sha256{Sha256: digest}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GCP KMS signing operation failed: %v", err)
+	}
+	return resp.Signature, nil
+}
@@ -0,0 +1,239 @@
+package casigner
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+	"golang.org/x/crypto/ssh"
+)
+
+// PKCS11Signer signs with a key held in a PKCS#11 token (YubiHSM, SoftHSM, etc), so the CA private
+// key material never exists outside the token.
+type PKCS11Signer struct {
+	ctx      *pkcs11.Ctx
+	session  pkcs11.SessionHandle
+	keyLabel string
+	signer   ssh.Signer
+}
+
+// NewPKCS11Signer opens the PKCS#11 module and logs into the token described by location, which
+// takes the form "<module-path>#<slot>#<key-label>", eg
+// "/usr/lib/softhsm/libsofthsm2.so#0#keybaseca-ca". The token PIN is read from the
+// CA_PKCS11_PIN environment variable.
+func NewPKCS11Signer(location string) (*PKCS11Signer, error) {
+	parts := strings.SplitN(location, "#", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf(`invalid pkcs11 backend location %q, expected "<module-path>#<slot>#<key-label>"`, location)
+	}
+	modulePath, slotStr, keyLabel := parts[0], parts[1], parts[2]
+	slot, err := strconv.ParseUint(slotStr, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkcs11 slot %q: %v", slotStr, err)
+	}
+
+	ctx := pkcs11.New(modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load pkcs11 module at %s", modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize pkcs11 module: %v", err)
+	}
+
+	session, err := ctx.OpenSession(uint(slot), pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pkcs11 session on slot %d: %v", slot, err)
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, pkcsPIN()); err != nil {
+		return nil, fmt.Errorf("failed to log into pkcs11 token: %v", err)
+	}
+
+	signer, err := newPKCS11CryptoSigner(ctx, session, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	sshSigner, err := ssh.NewSignerFromSigner(signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap pkcs11 key %s as an ssh.Signer: %v", keyLabel, err)
+	}
+
+	return &PKCS11Signer{ctx: ctx, session: session, keyLabel: keyLabel, signer: sshSigner}, nil
+}
+
+// oidP256 is the DER encoding of the secp256r1/P-256 named curve OID (1.2.840.10045.3.1.7), the
+// curve every key this package generates or loads uses.
+var oidP256 = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+
+// CreatePKCS11Signer generates a brand new EC P-256 keypair under the label in location (the same
+// "<module-path>#<slot>#<key-label>" form NewPKCS11Signer loads from) and returns a signer for it.
+func CreatePKCS11Signer(location string) (*PKCS11Signer, error) {
+	parts := strings.SplitN(location, "#", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf(`invalid pkcs11 backend location %q, expected "<module-path>#<slot>#<key-label>"`, location)
+	}
+	modulePath, slotStr, keyLabel := parts[0], parts[1], parts[2]
+	slot, err := strconv.ParseUint(slotStr, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkcs11 slot %q: %v", slotStr, err)
+	}
+
+	ctx := pkcs11.New(modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load pkcs11 module at %s", modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize pkcs11 module: %v", err)
+	}
+	session, err := ctx.OpenSession(uint(slot), pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pkcs11 session on slot %d: %v", slot, err)
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, pkcsPIN()); err != nil {
+		return nil, fmt.Errorf("failed to log into pkcs11 token: %v", err)
+	}
+
+	publicKeyTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, oidP256),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+	}
+	privateKeyTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+	}
+	_, _, err = ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		publicKeyTemplate, privateKeyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate pkcs11 keypair labeled %s: %v", keyLabel, err)
+	}
+
+	signer, err := newPKCS11CryptoSigner(ctx, session, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	sshSigner, err := ssh.NewSignerFromSigner(signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap pkcs11 key %s as an ssh.Signer: %v", keyLabel, err)
+	}
+	return &PKCS11Signer{ctx: ctx, session: session, keyLabel: keyLabel, signer: sshSigner}, nil
+}
+
+func (p *PKCS11Signer) Public() ssh.PublicKey {
+	return p.signer.PublicKey()
+}
+
+func (p *PKCS11Signer) SignCert(cert *ssh.Certificate) error {
+	return signWithRand(cert, p.signer)
+}
+
+func (p *PKCS11Signer) SignBytes(data []byte) (*ssh.Signature, error) {
+	return p.signer.Sign(rand.Reader, data)
+}
+
+func (p *PKCS11Signer) Exportable() bool {
+	return false
+}
+
+func (p *PKCS11Signer) Export() ([]byte, error) {
+	return nil, fmt.Errorf("CA key %s is held in a pkcs11 token and cannot be exported", p.keyLabel)
+}
+
+// pkcs11CryptoSigner adapts a PKCS#11 private key object to the crypto.Signer interface so it can
+// be wrapped with ssh.NewSignerFromSigner.
+type pkcs11CryptoSigner struct {
+	ctx       *pkcs11.Ctx
+	session   pkcs11.SessionHandle
+	publicKey crypto.PublicKey
+	handle    pkcs11.ObjectHandle
+}
+
+func newPKCS11CryptoSigner(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, keyLabel string) (*pkcs11CryptoSigner, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return nil, fmt.Errorf("failed to search for pkcs11 key %s: %v", keyLabel, err)
+	}
+	defer ctx.FindObjectsFinal(session)
+	handles, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for pkcs11 key %s: %v", keyLabel, err)
+	}
+	if len(handles) == 0 {
+		return nil, fmt.Errorf("no pkcs11 private key found with label %s", keyLabel)
+	}
+
+	pub, err := publicKeyForLabel(ctx, session, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	return &pkcs11CryptoSigner{ctx: ctx, session: session, publicKey: pub, handle: handles[0]}, nil
+}
+
+func (s *pkcs11CryptoSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *pkcs11CryptoSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, s.handle); err != nil {
+		return nil, fmt.Errorf("failed to initialize pkcs11 signing operation: %v", err)
+	}
+	raw, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, err
+	}
+	return ecdsaRawToASN1(raw)
+}
+
+// ecdsaRawToASN1 converts the raw, fixed-length r||s signature CKM_ECDSA returns into the ASN.1
+// DER SEQUENCE{r, s} that crypto.Signer.Sign is expected to return for an ECDSA key (and that
+// golang.org/x/crypto/ssh's wrappedSigner unconditionally asn1.Unmarshals). AWS and GCP KMS return
+// DER natively; PKCS#11 does not, so this backend has to do the conversion itself.
+func ecdsaRawToASN1(raw []byte) ([]byte, error) {
+	if len(raw)%2 != 0 {
+		return nil, fmt.Errorf("pkcs11 ECDSA signature has odd length %d, expected an even r||s concatenation", len(raw))
+	}
+	half := len(raw) / 2
+	r := new(big.Int).SetBytes(raw[:half])
+	s := new(big.Int).SetBytes(raw[half:])
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{r, s})
+}
+
+func publicKeyForLabel(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, keyLabel string) (crypto.PublicKey, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return nil, fmt.Errorf("failed to search for pkcs11 public key %s: %v", keyLabel, err)
+	}
+	defer ctx.FindObjectsFinal(session)
+	handles, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for pkcs11 public key %s: %v", keyLabel, err)
+	}
+	if len(handles) == 0 {
+		return nil, fmt.Errorf("no pkcs11 public key found with label %s", keyLabel)
+	}
+	attrs, err := ctx.GetAttributeValue(session, handles[0], []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pkcs11 public key %s: %v", keyLabel, err)
+	}
+	return ecPointToPublicKey(attrs[0].Value)
+}
@@ -0,0 +1,31 @@
+package casigner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"os"
+)
+
+// pkcsPIN reads the PKCS#11 token PIN from the environment rather than taking it as a CLI flag so
+// that it never ends up in a process listing or shell history.
+func pkcsPIN() string {
+	return os.Getenv("CA_PKCS11_PIN")
+}
+
+// ecPointToPublicKey decodes a CKA_EC_POINT attribute (an ASN.1 OCTET STRING wrapping an
+// uncompressed SEC1 point) into an *ecdsa.PublicKey. Keys provisioned for keybaseca's CA use
+// P-256, matching the curve ssh-keygen defaults to for ECDSA CA keys.
+func ecPointToPublicKey(ecPoint []byte) (*ecdsa.PublicKey, error) {
+	// Strip the leading ASN.1 OCTET STRING header (0x04 <len>) that wraps the raw point.
+	if len(ecPoint) < 2 || ecPoint[0] != 0x04 {
+		return nil, fmt.Errorf("unexpected CKA_EC_POINT encoding")
+	}
+	point := ecPoint[2:]
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, fmt.Errorf("failed to unmarshal EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
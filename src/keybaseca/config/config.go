@@ -0,0 +1,109 @@
+// Package config defines the Config interface that every keybaseca command reads its settings
+// through, and EnvConfig, the environment-variable-backed implementation used in practice.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config is the set of settings a running CA needs: which teams it signs for and chats in, where
+// its key and logs live, and how long certificates it issues should be valid for.
+type Config interface {
+	// GetTeams returns the teams this CA signs certificates for and publishes KBFS state to.
+	GetTeams() []string
+	// GetHostsTeams returns the teams allowed to request host certificates via `!ssh sign-host`.
+	// Minting a host certificate is a stronger grant than an ordinary user cert -- every client
+	// trusts the named hostname as a result -- so it's gated by this separate, narrower allowlist
+	// instead of GetTeams().
+	GetHostsTeams() []string
+	// GetChatTeam returns the team the bot listens for `!ssh sign` requests in, or "" if requests
+	// may come from a channel in any of GetTeams().
+	GetChatTeam() string
+	// GetChannelName returns the channel within GetChatTeam() the bot listens in, or "" for any
+	// channel, or if GetChatTeam() is unset.
+	GetChannelName() string
+	// GetCAKeyLocation returns the filesystem path to the CA's private key.
+	GetCAKeyLocation() string
+	// GetKeyExpiration returns the validity duration (eg "+5m") new certificates are issued with.
+	GetKeyExpiration() string
+	// GetLogLocation returns where the CA's log file lives.
+	GetLogLocation() string
+	// GetProfilesConfigPath returns the path to the `profiles:` YAML file the bot loads profiles
+	// from, or "" if the bot should only serve unrestricted sign requests.
+	GetProfilesConfigPath() string
+}
+
+// EnvConfig reads Config's settings from environment variables, the long-standing way of
+// configuring keybaseca (there has never been a config file for the server side).
+type EnvConfig struct{}
+
+func (e EnvConfig) GetTeams() []string {
+	return splitAndTrim(os.Getenv("TEAMS"))
+}
+
+func (e EnvConfig) GetHostsTeams() []string {
+	return splitAndTrim(os.Getenv("HOSTS_TEAMS"))
+}
+
+func (e EnvConfig) GetChatTeam() string {
+	return os.Getenv("CHAT_TEAM")
+}
+
+func (e EnvConfig) GetChannelName() string {
+	return os.Getenv("CHANNEL_NAME")
+}
+
+func (e EnvConfig) GetCAKeyLocation() string {
+	return os.Getenv("CA_KEY_LOCATION")
+}
+
+func (e EnvConfig) GetKeyExpiration() string {
+	if expiration := os.Getenv("KEY_EXPIRATION"); expiration != "" {
+		return expiration
+	}
+	return "+5m"
+}
+
+func (e EnvConfig) GetLogLocation() string {
+	if location := os.Getenv("LOG_LOCATION"); location != "" {
+		return location
+	}
+	return "/tmp/keybaseca.log"
+}
+
+func (e EnvConfig) GetProfilesConfigPath() string {
+	return os.Getenv("PROFILES_CONFIG")
+}
+
+// ValidateConfig checks that conf has the settings a running CA needs. skipTeamValidation skips
+// the checks that only make sense when the CA is actually going to talk to Keybase (used by `sign`
+// and `sign-host`, which only need a CA key location and have no Keybase dependency).
+func ValidateConfig(conf Config, skipTeamValidation bool) error {
+	if conf.GetCAKeyLocation() == "" {
+		return fmt.Errorf("CA_KEY_LOCATION must be set")
+	}
+	if skipTeamValidation {
+		return nil
+	}
+	if len(conf.GetTeams()) == 0 {
+		return fmt.Errorf("TEAMS must be set to a comma separated list of teams")
+	}
+	return nil
+}
+
+func splitAndTrim(value string) []string {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	trimmed := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			trimmed = append(trimmed, part)
+		}
+	}
+	return trimmed
+}
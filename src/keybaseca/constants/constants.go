@@ -0,0 +1,86 @@
+// Package constants defines the KBFSOperations interface used throughout keybaseca to read and
+// write files under the /keybase/ mount, plus the default implementation backed by that mount.
+package constants
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// KBFSOperations is satisfied by anything that can read, write, delete, and list files published
+// to KBFS (team directories under /keybase/team/<team>/), so that code which needs to publish or
+// read a file from KBFS doesn't have to care whether that's a local mount or something else.
+type KBFSOperations interface {
+	// KBFSWrite writes contents to filename, creating any missing parent directories. If a file
+	// already exists at filename and overwriteExisting is false, it returns an error instead of
+	// clobbering it.
+	KBFSWrite(filename string, contents string, overwriteExisting bool) error
+	// KBFSRead returns the contents of filename.
+	KBFSRead(filename string) (string, error)
+	// KBFSDelete removes filename.
+	KBFSDelete(filename string) error
+	// KBFSFileExists reports whether filename exists.
+	KBFSFileExists(filename string) (bool, error)
+	// KBFSList returns the names of the entries directly inside path.
+	KBFSList(path string) ([]string, error)
+}
+
+// defaultKBFSOperations implements KBFSOperations against the locally FUSE-mounted KBFS
+// filesystem at /keybase, which is why every KBFS path elsewhere in this codebase is just a plain
+// filesystem path rather than going through a KBFS-specific client.
+type defaultKBFSOperations struct{}
+
+// GetDefaultKBFSOperationsStruct returns the KBFSOperations implementation used outside of tests:
+// plain filesystem access to the locally mounted /keybase directory.
+func GetDefaultKBFSOperationsStruct() KBFSOperations {
+	return defaultKBFSOperations{}
+}
+
+func (defaultKBFSOperations) KBFSWrite(filename string, contents string, overwriteExisting bool) error {
+	if !overwriteExisting {
+		if _, err := os.Stat(filename); err == nil {
+			return fmt.Errorf("refusing to overwrite existing KBFS file at %s", filename)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create KBFS directory for %s: %v", filename, err)
+	}
+	return ioutil.WriteFile(filename, []byte(contents), 0644)
+}
+
+func (defaultKBFSOperations) KBFSRead(filename string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func (defaultKBFSOperations) KBFSDelete(filename string) error {
+	return os.Remove(filename)
+}
+
+func (defaultKBFSOperations) KBFSFileExists(filename string) (bool, error) {
+	_, err := os.Stat(filename)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (defaultKBFSOperations) KBFSList(path string) ([]string, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, nil
+}
@@ -0,0 +1,109 @@
+// Package profiles implements per-team certificate signing policies: named profiles that bound
+// which principals, extensions, critical options, and validity a team's members may request,
+// replacing the old one-size-fits-all "all teams, all permissions, one TTL" signing behavior.
+package profiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Profile is one named signing policy. Principals may use `{kb_user}` templating, which is
+// substituted with the requesting user's Keybase username when a certificate is issued.
+type Profile struct {
+	Name            string            `yaml:"name"`
+	Teams           []string          `yaml:"teams"`
+	Principals      []string          `yaml:"principals"`
+	Extensions      []string          `yaml:"extensions"`
+	CriticalOptions map[string]string `yaml:"critical_options"`
+	Validity        string            `yaml:"validity"`
+	KeyIDTemplate   string            `yaml:"key_id_template"`
+}
+
+// profilesConfig is the shape of the `profiles:` block in the server config file.
+type profilesConfig struct {
+	Profiles []Profile `yaml:"profiles"`
+}
+
+// LoadProfiles parses the `profiles:` block out of the YAML document at path.
+func LoadProfiles(path string) ([]Profile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles config at %s: %v", path, err)
+	}
+	var parsed profilesConfig
+	err = yaml.Unmarshal(content, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profiles config at %s: %v", path, err)
+	}
+	for _, profile := range parsed.Profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("profiles config at %s has a profile with no name", path)
+		}
+	}
+	return parsed.Profiles, nil
+}
+
+// Select returns the named profile if the requesting user's teams intersect with the profile's
+// allowed teams, so that a request for a profile its team isn't granted is rejected rather than
+// silently falling back to another profile.
+func Select(availableProfiles []Profile, name string, requestingUserTeams []string) (*Profile, error) {
+	for _, profile := range availableProfiles {
+		if profile.Name != name {
+			continue
+		}
+		if !intersects(profile.Teams, requestingUserTeams) {
+			return nil, fmt.Errorf("requested profile %q is not granted to any of this user's teams", name)
+		}
+		return &profile, nil
+	}
+	return nil, fmt.Errorf("no profile named %q is configured", name)
+}
+
+// Get returns the named profile with no team-membership check, for callers that have no real
+// per-request identity to check against (the Keybase-less `keybaseca sign --profile` CLI path,
+// where whoever can invoke the CLI already has CA key access). Callers with a real requester
+// identity -- the chatbot -- should use Select instead so a profile's team restriction is
+// actually enforced.
+func Get(availableProfiles []Profile, name string) (*Profile, error) {
+	for _, profile := range availableProfiles {
+		if profile.Name == name {
+			return &profile, nil
+		}
+	}
+	return nil, fmt.Errorf("no profile named %q is configured", name)
+}
+
+func intersects(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, v := range a {
+		set[v] = true
+	}
+	for _, v := range b {
+		if set[v] {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderPrincipals substitutes `{kb_user}` in the profile's principals with kbUser and joins them
+// in the comma separated form SignKey expects.
+func (p Profile) RenderPrincipals(kbUser string) string {
+	rendered := make([]string, len(p.Principals))
+	for i, principal := range p.Principals {
+		rendered[i] = strings.ReplaceAll(principal, "{kb_user}", kbUser)
+	}
+	return strings.Join(rendered, ",")
+}
+
+// RenderKeyID substitutes `{kb_user}` in the profile's key ID template with kbUser.
+func (p Profile) RenderKeyID(kbUser string) string {
+	if p.KeyIDTemplate == "" {
+		return kbUser + ":keybaseca-sign"
+	}
+	return strings.ReplaceAll(p.KeyIDTemplate, "{kb_user}", kbUser)
+}
@@ -0,0 +1,81 @@
+package profiles
+
+import "testing"
+
+func testProfiles() []Profile {
+	return []Profile{
+		{
+			Name:       "prod-readers",
+			Teams:      []string{"acme.prod-readers"},
+			Principals: []string{"{kb_user}", "readonly"},
+			Validity:   "8h",
+		},
+		{
+			Name:          "prod-admins",
+			Teams:         []string{"acme.prod-admins"},
+			Principals:    []string{"root"},
+			KeyIDTemplate: "{kb_user}:prod-admin",
+		},
+	}
+}
+
+func TestSelectGrantsWhenTeamsIntersect(t *testing.T) {
+	profile, err := Select(testProfiles(), "prod-readers", []string{"acme.prod-readers", "acme.everyone"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if profile.Name != "prod-readers" {
+		t.Fatalf("got profile %q, want prod-readers", profile.Name)
+	}
+}
+
+func TestSelectRejectsWhenTeamsDoNotIntersect(t *testing.T) {
+	_, err := Select(testProfiles(), "prod-admins", []string{"acme.prod-readers"})
+	if err == nil {
+		t.Fatal("expected an error for a user with no membership in the profile's allowed teams")
+	}
+}
+
+func TestSelectRejectsUnknownProfile(t *testing.T) {
+	_, err := Select(testProfiles(), "does-not-exist", []string{"acme.prod-readers"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown profile name")
+	}
+}
+
+func TestGetIgnoresTeamMembership(t *testing.T) {
+	profile, err := Get(testProfiles(), "prod-admins")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if profile.Name != "prod-admins" {
+		t.Fatalf("got profile %q, want prod-admins", profile.Name)
+	}
+}
+
+func TestRenderPrincipalsSubstitutesKBUser(t *testing.T) {
+	profile := testProfiles()[0]
+	got := profile.RenderPrincipals("alice")
+	want := "alice,readonly"
+	if got != want {
+		t.Fatalf("got principals %q, want %q", got, want)
+	}
+}
+
+func TestRenderKeyIDUsesDefaultWithoutTemplate(t *testing.T) {
+	profile := testProfiles()[0]
+	got := profile.RenderKeyID("alice")
+	want := "alice:keybaseca-sign"
+	if got != want {
+		t.Fatalf("got key ID %q, want %q", got, want)
+	}
+}
+
+func TestRenderKeyIDSubstitutesTemplate(t *testing.T) {
+	profile := testProfiles()[1]
+	got := profile.RenderKeyID("alice")
+	want := "alice:prod-admin"
+	if got != want {
+		t.Fatalf("got key ID %q, want %q", got, want)
+	}
+}
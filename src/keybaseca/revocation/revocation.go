@@ -0,0 +1,227 @@
+// Package revocation implements certificate revocation: an issuance index that lets operators
+// revoke by human-meaningful criteria (a Keybase username) instead of only by the random
+// UUID key ID a cert was issued with, and publication of the resulting OpenSSH Key Revocation List
+// (KRL) to every team so kssh and sshd can refresh what they distrust.
+package revocation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/config"
+	"github.com/keybase/bot-sshca/src/keybaseca/constants"
+)
+
+// IndexFilename, KRLFilename, and SerialFilename are published to every team's KBFS directory,
+// alongside the client config that writeClientConfig already places there.
+const (
+	IndexFilename  = "issuance-index.json"
+	KRLFilename    = "revocations.krl"
+	SerialFilename = "revocation-serial"
+)
+
+// IssuanceRecord tracks one certificate this CA has signed, so that it can later be revoked by
+// key ID or by the Keybase user it was issued to. Team is recorded but there is no revocation by
+// team.
+type IssuanceRecord struct {
+	KeyID             string    `json:"key_id"`
+	KBUser            string    `json:"kb_user"`
+	Team              string    `json:"team"`
+	Expiration        string    `json:"expiration"`
+	PubkeyFingerprint string    `json:"pubkey_fingerprint"`
+	IssuedAt          time.Time `json:"issued_at"`
+	Revoked           bool      `json:"revoked"`
+}
+
+// RecordIssuance appends a new entry to the issuance index for a certificate that was just signed.
+func RecordIssuance(conf config.Config, record IssuanceRecord) error {
+	index, err := loadIndex(conf)
+	if err != nil {
+		return err
+	}
+	record.IssuedAt = time.Now()
+	index = append(index, record)
+	return saveIndex(conf, index)
+}
+
+// RevokeByKeyID marks the issuance record for keyID as revoked and republishes the KRL, returning
+// the new revocation serial number.
+func RevokeByKeyID(conf config.Config, keyID string) (uint64, error) {
+	return revokeMatching(conf, func(r IssuanceRecord) bool { return r.KeyID == keyID })
+}
+
+// RevokeByPrincipal marks every issuance record for kbUser as revoked and republishes the KRL,
+// returning the new revocation serial number.
+func RevokeByPrincipal(conf config.Config, kbUser string) (uint64, error) {
+	return revokeMatching(conf, func(r IssuanceRecord) bool { return r.KBUser == kbUser })
+}
+
+func revokeMatching(conf config.Config, matches func(IssuanceRecord) bool) (uint64, error) {
+	index, err := loadIndex(conf)
+	if err != nil {
+		return 0, err
+	}
+
+	matched := 0
+	for i, record := range index {
+		if matches(record) {
+			index[i].Revoked = true
+			matched++
+		}
+	}
+	if matched == 0 {
+		return 0, fmt.Errorf("no issuance records matched; nothing to revoke")
+	}
+
+	err = saveIndex(conf, index)
+	if err != nil {
+		return 0, err
+	}
+	return publishKRL(conf, index)
+}
+
+func loadIndex(conf config.Config) ([]IssuanceRecord, error) {
+	teams := conf.GetTeams()
+	if len(teams) == 0 {
+		return nil, fmt.Errorf("no teams configured, cannot locate the issuance index")
+	}
+	filename := filepath.Join("/keybase/team/", teams[0], IndexFilename)
+	content, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read issuance index at %s: %v", filename, err)
+	}
+	if content == "" {
+		return nil, nil
+	}
+	var index []IssuanceRecord
+	err = json.Unmarshal([]byte(content), &index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuance index: %v", err)
+	}
+	return index, nil
+}
+
+func saveIndex(conf config.Config, index []IssuanceRecord) error {
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal issuance index: %v", err)
+	}
+	for _, team := range conf.GetTeams() {
+		filename := filepath.Join("/keybase/team/", team, IndexFilename)
+		err = constants.GetDefaultKBFSOperationsStruct().KBFSWrite(filename, string(content), true)
+		if err != nil {
+			return fmt.Errorf("failed to publish issuance index to team %s: %v", team, err)
+		}
+	}
+	return nil
+}
+
+// publishKRL rebuilds the KRL from every revoked key ID in index via `ssh-keygen -k`, bumps the
+// revocation serial, and publishes both to every configured team.
+func publishKRL(conf config.Config, index []IssuanceRecord) (uint64, error) {
+	specFile, err := ioutil.TempFile("", "keybaseca-krl-spec")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create a temporary KRL spec file: %v", err)
+	}
+	defer os.Remove(specFile.Name())
+	for _, record := range index {
+		if record.Revoked {
+			_, err = fmt.Fprintf(specFile, "id: %s\n", record.KeyID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to write KRL spec file: %v", err)
+			}
+		}
+	}
+	err = specFile.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	krlFile, err := ioutil.TempFile("", "keybaseca-krl")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create a temporary KRL file: %v", err)
+	}
+	krlPath := krlFile.Name()
+	krlFile.Close()
+	defer os.Remove(krlPath)
+	os.Remove(krlPath) // ssh-keygen -k refuses to overwrite an existing file
+
+	cmd := exec.Command("ssh-keygen", "-k", "-f", krlPath, "-s", conf.GetCAKeyLocation()+".pub", specFile.Name())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("ssh-keygen -k failed: %v: %s", err, string(output))
+	}
+
+	krlContent, err := ioutil.ReadFile(krlPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read generated KRL: %v", err)
+	}
+
+	serial, err := nextSerial(conf)
+	if err != nil {
+		return 0, err
+	}
+	for _, team := range conf.GetTeams() {
+		krlFilename := filepath.Join("/keybase/team/", team, KRLFilename)
+		err = constants.GetDefaultKBFSOperationsStruct().KBFSWrite(krlFilename, string(krlContent), true)
+		if err != nil {
+			return 0, fmt.Errorf("failed to publish KRL to team %s: %v", team, err)
+		}
+		serialFilename := filepath.Join("/keybase/team/", team, SerialFilename)
+		err = constants.GetDefaultKBFSOperationsStruct().KBFSWrite(serialFilename, fmt.Sprintf("%d", serial), true)
+		if err != nil {
+			return 0, fmt.Errorf("failed to publish revocation serial to team %s: %v", team, err)
+		}
+	}
+	return serial, nil
+}
+
+func nextSerial(conf config.Config) (uint64, error) {
+	teams := conf.GetTeams()
+	if len(teams) == 0 {
+		return 0, fmt.Errorf("no teams configured, cannot track the revocation serial")
+	}
+	current, err := ReadSerialForTeam(teams[0])
+	if err != nil {
+		return 0, err
+	}
+	return current + 1, nil
+}
+
+// ReadSerialForTeam returns the revocation serial currently published to team's KBFS directory (0
+// if nothing has ever been revoked). Unlike nextSerial, it needs no config.Config, so kssh clients
+// can use it to tell whether their locally cached KRL is stale.
+func ReadSerialForTeam(team string) (uint64, error) {
+	filename := filepath.Join("/keybase/team/", team, SerialFilename)
+	content, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read revocation serial at %s: %v", filename, err)
+	}
+	if content == "" {
+		return 0, nil
+	}
+	var current uint64
+	_, err = fmt.Sscanf(content, "%d", &current)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse revocation serial: %v", err)
+	}
+	return current, nil
+}
+
+// ReadKRLForTeam returns the current KRL contents published to team's KBFS directory.
+func ReadKRLForTeam(team string) (string, error) {
+	filename := filepath.Join("/keybase/team/", team, KRLFilename)
+	content, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read KRL at %s: %v", filename, err)
+	}
+	return content, nil
+}
@@ -0,0 +1,57 @@
+package revocation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestIssuanceRecordJSONRoundTrip(t *testing.T) {
+	original := IssuanceRecord{
+		KeyID:             "uuid-1:keybaseca-sign",
+		KBUser:            "alice",
+		Team:              "acme.prod",
+		Expiration:        "24h",
+		PubkeyFingerprint: "SHA256:abc",
+		IssuedAt:          time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Revoked:           true,
+	}
+
+	bytes, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("failed to marshal issuance record: %v", err)
+	}
+
+	var decoded IssuanceRecord
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal issuance record: %v", err)
+	}
+	if decoded != original {
+		t.Fatalf("round trip changed the record: got %+v, want %+v", decoded, original)
+	}
+}
+
+func TestIndexJSONRoundTrip(t *testing.T) {
+	index := []IssuanceRecord{
+		{KeyID: "uuid-1:keybaseca-sign", KBUser: "alice", Revoked: false},
+		{KeyID: "uuid-2:keybaseca-sign", KBUser: "bob", Revoked: true},
+	}
+
+	bytes, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal index: %v", err)
+	}
+
+	var decoded []IssuanceRecord
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal index: %v", err)
+	}
+	if len(decoded) != len(index) {
+		t.Fatalf("got %d records, want %d", len(decoded), len(index))
+	}
+	for i := range index {
+		if decoded[i] != index[i] {
+			t.Fatalf("record %d: got %+v, want %+v", i, decoded[i], index[i])
+		}
+	}
+}
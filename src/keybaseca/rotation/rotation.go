@@ -0,0 +1,155 @@
+// Package rotation implements zero-downtime rotation of the CA's signing keypair: a new key is
+// generated and used for signing immediately, while the old key's public half stays published
+// alongside it for a grace period so that already-provisioned servers (which trust it via
+// TrustedUserCAKeys) keep working until they are updated to trust the new key.
+package rotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/config"
+	"github.com/keybase/bot-sshca/src/keybaseca/constants"
+	"github.com/keybase/bot-sshca/src/keybaseca/sshutils"
+)
+
+// ManifestFilename is the name of the rotation manifest written to each team's KBFS directory next
+// to the client config that writeClientConfig already places there. kssh and sshd's
+// AuthorizedKeysCommand helpers read it to know when the old CA key may be dropped from trust.
+const ManifestFilename = "ca-rotation.json"
+
+// Manifest records the state of an in-progress or completed CA key rotation.
+type Manifest struct {
+	OldKeyFingerprint string    `json:"old_key_fingerprint"`
+	NewKeyFingerprint string    `json:"new_key_fingerprint"`
+	RotatedAt         time.Time `json:"rotated_at"`
+	GraceDeadline     time.Time `json:"grace_deadline"`
+	OldKeyRemoved     bool      `json:"old_key_removed"`
+}
+
+// Rotate generates a fresh CA keypair, publishes both the old and new CA public keys as trusted
+// keys to every configured team for the duration of gracePeriod, and switches the CA over to
+// signing with the new key immediately. It returns the manifest that was written to KBFS.
+func Rotate(conf config.Config, gracePeriod time.Duration) (*Manifest, error) {
+	oldKeyLocation := conf.GetCAKeyLocation()
+	oldPub, err := ioutil.ReadFile(oldKeyLocation + ".pub")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current CA public key at %s.pub: %v", oldKeyLocation, err)
+	}
+	oldFingerprint, err := sshutils.FingerprintPublicKey(string(oldPub))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint current CA public key: %v", err)
+	}
+
+	newKeyLocation := oldKeyLocation + ".new"
+	err = sshutils.GenerateAt(newKeyLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate new CA keypair: %v", err)
+	}
+	newPub, err := ioutil.ReadFile(newKeyLocation + ".pub")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read newly generated CA public key at %s.pub: %v", newKeyLocation, err)
+	}
+	newFingerprint, err := sshutils.FingerprintPublicKey(string(newPub))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint new CA public key: %v", err)
+	}
+
+	now := time.Now()
+	manifest := &Manifest{
+		OldKeyFingerprint: oldFingerprint,
+		NewKeyFingerprint: newFingerprint,
+		RotatedAt:         now,
+		GraceDeadline:     now.Add(gracePeriod),
+	}
+
+	trustBundle := strings.TrimSpace(string(oldPub)) + "\n" + strings.TrimSpace(string(newPub)) + "\n"
+	err = publishToEveryTeam(conf, trustBundle, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cut the new key over for signing immediately; the old key is left on disk as
+	// <location>.retired rather than deleted. EndGracePeriod does not read it: the old key's
+	// fingerprint is already in the manifest.
+	err = sshutils.ReplaceCAKey(oldKeyLocation, newKeyLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cut over to the new CA key: %v", err)
+	}
+	return manifest, nil
+}
+
+// EndGracePeriod drops the old CA key from the published trust bundle once its grace period has
+// elapsed, leaving only the new key trusted, and marks the manifest accordingly.
+func EndGracePeriod(conf config.Config) (*Manifest, error) {
+	manifest, err := loadManifest(conf)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Before(manifest.GraceDeadline) {
+		return nil, fmt.Errorf("grace period does not end until %s", manifest.GraceDeadline)
+	}
+
+	newPub, err := ioutil.ReadFile(conf.GetCAKeyLocation() + ".pub")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current CA public key: %v", err)
+	}
+	manifest.OldKeyRemoved = true
+	err = publishToEveryTeam(conf, strings.TrimSpace(string(newPub))+"\n", manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func publishToEveryTeam(conf config.Config, trustBundle string, manifest *Manifest) error {
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal rotation manifest: %v", err)
+	}
+
+	teams := conf.GetTeams()
+	for _, team := range teams {
+		trustFilename := filepath.Join("/keybase/team/", team, "trusted-ca-keys")
+		err = constants.GetDefaultKBFSOperationsStruct().KBFSWrite(trustFilename, trustBundle, true)
+		if err != nil {
+			return fmt.Errorf("failed to publish trusted CA keys to team %s: %v", team, err)
+		}
+
+		manifestFilename := filepath.Join("/keybase/team/", team, ManifestFilename)
+		err = constants.GetDefaultKBFSOperationsStruct().KBFSWrite(manifestFilename, string(manifestBytes), true)
+		if err != nil {
+			return fmt.Errorf("failed to publish rotation manifest to team %s: %v", team, err)
+		}
+	}
+	return nil
+}
+
+func loadManifest(conf config.Config) (*Manifest, error) {
+	teams := conf.GetTeams()
+	if len(teams) == 0 {
+		return nil, fmt.Errorf("no teams configured, cannot locate a rotation manifest")
+	}
+	return LoadManifestForTeam(teams[0])
+}
+
+// LoadManifestForTeam reads the rotation manifest published to team's KBFS directory. Unlike
+// loadManifest, it needs no config.Config, so kssh clients (which have no CA key or server
+// settings of their own) can use it to reconcile which CA public keys they should currently trust.
+func LoadManifestForTeam(team string) (*Manifest, error) {
+	filename := filepath.Join("/keybase/team/", team, ManifestFilename)
+	content, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rotation manifest at %s: %w", filename, err)
+	}
+	var manifest Manifest
+	err = json.Unmarshal([]byte(content), &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rotation manifest: %v", err)
+	}
+	return &manifest, nil
+}
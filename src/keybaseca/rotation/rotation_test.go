@@ -0,0 +1,48 @@
+package rotation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestManifestJSONRoundTrip(t *testing.T) {
+	original := Manifest{
+		OldKeyFingerprint: "SHA256:old",
+		NewKeyFingerprint: "SHA256:new",
+		RotatedAt:         time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		GraceDeadline:     time.Date(2026, 1, 9, 3, 4, 5, 0, time.UTC),
+		OldKeyRemoved:     false,
+	}
+
+	bytes, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %v", err)
+	}
+
+	var decoded Manifest
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+	if decoded != original {
+		t.Fatalf("round trip changed the manifest: got %+v, want %+v", decoded, original)
+	}
+}
+
+func TestManifestJSONUsesSnakeCaseFieldNames(t *testing.T) {
+	manifest := Manifest{OldKeyFingerprint: "SHA256:old", NewKeyFingerprint: "SHA256:new"}
+	bytes, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(bytes, &raw); err != nil {
+		t.Fatalf("failed to unmarshal manifest into a map: %v", err)
+	}
+	for _, field := range []string{"old_key_fingerprint", "new_key_fingerprint", "rotated_at", "grace_deadline", "old_key_removed"} {
+		if _, ok := raw[field]; !ok {
+			t.Errorf("expected JSON field %q, which kssh.RotationStatus's callers depend on", field)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package sshutils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/casigner"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SignHostKey signs a host public key as an OpenSSH host certificate (the `ssh-keygen -h`
+// equivalent of SignKey) with the given hostnames as valid principals, so that a client with a
+// `@cert-authority` line in known_hosts for this CA can verify the host on first connection
+// instead of TOFU-accepting its bare host key. caSigner is whichever CA key backend is currently
+// configured, same as SignKey.
+func SignHostKey(caSigner casigner.CASigner, keyID string, hostnames []string, expiration string, hostPubKey string) (string, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostPubKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse host public key: %v", err)
+	}
+
+	validBefore, err := parseExpiration(expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse expiration %q: %v", expiration, err)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.HostCert,
+		KeyId:           keyID,
+		ValidPrincipals: hostnames,
+		ValidAfter:      uint64(time.Now().Unix()),
+		ValidBefore:     validBefore,
+	}
+	err = caSigner.SignCert(cert)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign host certificate: %v", err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert)), nil
+}
+
+// parseExpiration turns an expiration string of the same "+5m"/"+24h" form accepted by SignKey's
+// expiration parameter into the Unix timestamp ssh.Certificate.ValidBefore expects.
+func parseExpiration(expiration string) (uint64, error) {
+	duration, err := time.ParseDuration(expiration)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(time.Now().Add(duration).Unix()), nil
+}
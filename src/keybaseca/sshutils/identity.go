@@ -0,0 +1,109 @@
+package sshutils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// IdentityBundle is a self-contained, on-disk-free SSH credential: an ephemeral private key, the
+// certificate the CA signed for it, and the CA public keys that a client should trust as
+// TrustedUserCAKeys. It is the payload handed back by `keybaseca sign --output-mode=agent` (loaded
+// straight into SSH_AUTH_SOCK) or `--output-mode=stdout-bundle` (printed to stdout as JSON, which
+// is not itself a key file `ssh -i` can read), so that a cert never has to touch the filesystem.
+type IdentityBundle struct {
+	PrivateKeyPEM string   `json:"private_key"`
+	CertificatePEM string  `json:"certificate"`
+	CAPublicKeys  []string `json:"ca_public_keys"`
+}
+
+// MarshalBundle serializes an IdentityBundle to the JSON wire format printed by --output-mode=stdout-bundle.
+func (b IdentityBundle) MarshalBundle() ([]byte, error) {
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// GenerateEphemeralKeypair creates a fresh ed25519 keypair for use with --output-mode=agent and
+// --output-mode=stdout-bundle, returning the private key as a PEM-encoded PKCS#8 block and the
+// public key in OpenSSH authorized_keys format. It never touches disk, so the private key only
+// ever exists in the IdentityBundle it ends up in.
+func GenerateEphemeralKeypair() (privateKeyPEM string, authorizedKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	marshaledPriv, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", "", err
+	}
+	pemBlock := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: marshaledPriv})
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return "", "", err
+	}
+	return string(pemBlock), string(ssh.MarshalAuthorizedKey(sshPub)), nil
+}
+
+// LoadCAPublicKeys reads the CA public keys (the current key and, during a rotation overlap
+// window, the previous key) that ought to be bundled alongside a freshly issued certificate.
+func LoadCAPublicKeys(caKeyLocations ...string) ([]string, error) {
+	keys := make([]string, 0, len(caKeyLocations))
+	for _, loc := range caKeyLocations {
+		bytes, err := ioutil.ReadFile(loc + ".pub")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA public key at %s.pub: %v", loc, err)
+		}
+		keys = append(keys, string(bytes))
+	}
+	return keys, nil
+}
+
+// LoadIntoAgent loads the private key and certificate from the given bundle into the ssh-agent
+// listening on SSH_AUTH_SOCK, with a lifetime matching the certificate's configured expiration so
+// that the agent automatically forgets the key once it would no longer be usable.
+func LoadIntoAgent(bundle IdentityBundle, lifetime time.Duration) error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return fmt.Errorf("SSH_AUTH_SOCK is not set; is an ssh-agent running?")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to ssh-agent at %s: %v", socket, err)
+	}
+	defer conn.Close()
+
+	key, err := ssh.ParseRawPrivateKey([]byte(bundle.PrivateKeyPEM))
+	if err != nil {
+		return fmt.Errorf("failed to parse generated private key: %v", err)
+	}
+	cert, _, _, _, err := ssh.ParseAuthorizedKey([]byte(bundle.CertificatePEM))
+	if err != nil {
+		return fmt.Errorf("failed to parse issued certificate: %v", err)
+	}
+	sshCert, ok := cert.(*ssh.Certificate)
+	if !ok {
+		return fmt.Errorf("expected an ssh certificate, got %T", cert)
+	}
+
+	a := agent.NewClient(conn)
+	err = a.Add(agent.AddedKey{
+		PrivateKey:   key,
+		Certificate:  sshCert,
+		LifetimeSecs: uint32(lifetime.Seconds()),
+		Comment:      "keybaseca: " + sshCert.KeyId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load certificate into ssh-agent: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package sshutils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/casigner"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SignKeyWithProfile signs pubKey the same way SignKey does, but with the extensions and critical
+// options (eg permit-pty, force-command, source-address) that a profiles.Profile grants, instead
+// of SignKey's default of every extension permitted. caSigner is whichever CA key backend is
+// currently configured, same as SignKey.
+func SignKeyWithProfile(caSigner casigner.CASigner, keyID, principals string, expiration string, pubKey string,
+	extensions []string, criticalOptions map[string]string) (string, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	validBefore, err := parseExpiration(expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse expiration %q: %v", expiration, err)
+	}
+
+	extensionSet := make(map[string]string, len(extensions))
+	for _, extension := range extensions {
+		extensionSet[extension] = ""
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: splitPrincipals(principals),
+		ValidAfter:      uint64(time.Now().Unix()),
+		ValidBefore:     validBefore,
+		Permissions: ssh.Permissions{
+			Extensions:      extensionSet,
+			CriticalOptions: criticalOptions,
+		},
+	}
+	err = caSigner.SignCert(cert)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign certificate: %v", err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert)), nil
+}
+
+func splitPrincipals(principals string) []string {
+	if principals == "" {
+		return nil
+	}
+	return strings.Split(principals, ",")
+}
@@ -0,0 +1,48 @@
+package sshutils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// FingerprintPublicKey returns the SHA256 fingerprint (in the same "SHA256:<base64>" format that
+// `ssh-keygen -lf` prints) of an authorized_keys-formatted public key, for use in rotation
+// manifests and audit records.
+func FingerprintPublicKey(authorizedKey string) (string, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %v", err)
+	}
+	sum := sha256.Sum256(pub.Marshal())
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// GenerateAt generates a new CA keypair at the given path, reusing the same key generation logic
+// as `keybaseca generate`, so that a rotation can stage a new key alongside the one currently in
+// use without disturbing it.
+func GenerateAt(location string) error {
+	return Generate(location, true)
+}
+
+// ReplaceCAKey swaps the CA key at currentLocation for the one staged at newLocation by
+// GenerateAt through four successive renames (the swap as a whole is not atomic), retiring the previous key to currentLocation+".retired" rather than deleting it so
+// that a rotation in its grace period can still reference its fingerprint.
+func ReplaceCAKey(currentLocation, newLocation string) error {
+	err := os.Rename(currentLocation, currentLocation+".retired")
+	if err != nil {
+		return fmt.Errorf("failed to retire old CA key: %v", err)
+	}
+	err = os.Rename(currentLocation+".pub", currentLocation+".retired.pub")
+	if err != nil {
+		return fmt.Errorf("failed to retire old CA public key: %v", err)
+	}
+	err = os.Rename(newLocation, currentLocation)
+	if err != nil {
+		return fmt.Errorf("failed to promote new CA key: %v", err)
+	}
+	return os.Rename(newLocation+".pub", currentLocation+".pub")
+}
@@ -0,0 +1,93 @@
+package sshutils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/casigner"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// unrestrictedExtensions are the certificate extensions SignKey grants, matching what a
+// regular (non profile-restricted) ssh-keygen-signed user certificate gets.
+var unrestrictedExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// Generate creates a new CA keypair at caKeyLocation (and caKeyLocation+".pub"). It refuses to
+// overwrite an existing key unless force is set.
+func Generate(caKeyLocation string, force bool) error {
+	if _, err := os.Stat(caKeyLocation); err == nil && !force {
+		return fmt.Errorf("a CA key already exists at %s; set FORCE_WRITE=true to overwrite it", caKeyLocation)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA keypair: %v", err)
+	}
+	marshaledPriv, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CA private key: %v", err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: marshaledPriv})
+	err = ioutil.WriteFile(caKeyLocation, privPEM, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write CA private key to %s: %v", caKeyLocation, err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("failed to derive CA public key: %v", err)
+	}
+	err = ioutil.WriteFile(caKeyLocation+".pub", ssh.MarshalAuthorizedKey(sshPub), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write CA public key to %s.pub: %v", caKeyLocation, err)
+	}
+	return nil
+}
+
+// SignKey signs pubKey as an OpenSSH user certificate valid for principals (a comma separated
+// list) until expiration (eg "+5m"), with every extension a normal SSH session needs and no
+// restrictions -- the long-standing, unrestricted signing behavior. Callers that need to bound
+// what a certificate grants use SignKeyWithProfile instead. caSigner is whichever CA key backend
+// (on-disk file, PKCS#11, AWS/GCP KMS) is currently configured; SignKey never touches a key file
+// directly so that signing works the same way regardless of backend.
+func SignKey(caSigner casigner.CASigner, keyID, principals, expiration, pubKey string) (string, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	validBefore, err := parseExpiration(expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse expiration %q: %v", expiration, err)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: splitPrincipals(principals),
+		ValidAfter:      uint64(time.Now().Unix()),
+		ValidBefore:     validBefore,
+		Permissions: ssh.Permissions{
+			Extensions: unrestrictedExtensions,
+		},
+	}
+	err = caSigner.SignCert(cert)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign certificate: %v", err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert)), nil
+}
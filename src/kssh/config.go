@@ -0,0 +1,12 @@
+// Package kssh implements the kssh client: discovering the CA bot to talk to from the config file
+// keybaseca publishes to KBFS, requesting certificates from it over Keybase chat, and reconciling
+// CA trust and revocation state as the CA rotates keys or revokes certificates.
+package kssh
+
+// ConfigFile is the client config keybaseca publishes to KBFS (see shared.ConfigFilename) so that
+// kssh can find the CA bot it should chat with without the user configuring anything by hand.
+type ConfigFile struct {
+	TeamName    string `json:"teamname"`
+	BotName     string `json:"botname"`
+	ChannelName string `json:"channelname"`
+}
@@ -0,0 +1,43 @@
+package kssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/constants"
+	"github.com/keybase/bot-sshca/src/shared"
+)
+
+// LoadConfig reads the kssh config file keybaseca published to team's KBFS directory.
+func LoadConfig(team string) (ConfigFile, error) {
+	filename := filepath.Join("/keybase/team/", team, shared.ConfigFilename)
+	content, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(filename)
+	if err != nil {
+		return ConfigFile{}, fmt.Errorf("failed to read kssh config at %s: %v", filename, err)
+	}
+	var cfg ConfigFile
+	err = json.Unmarshal([]byte(content), &cfg)
+	if err != nil {
+		return ConfigFile{}, fmt.Errorf("failed to parse kssh config at %s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+// DiscoverConfig finds a kssh config file without the caller naming a team: it lists every team
+// the local Keybase user is in and returns the config published to the first one that has one.
+// This is what lets a user just run `kssh id_ed25519.pub` without first looking up which team
+// their CA bot lives in.
+func DiscoverConfig() (ConfigFile, error) {
+	teams, err := constants.GetDefaultKBFSOperationsStruct().KBFSList("/keybase/team")
+	if err != nil {
+		return ConfigFile{}, fmt.Errorf("failed to list Keybase teams: %v", err)
+	}
+	for _, team := range teams {
+		cfg, err := LoadConfig(team)
+		if err == nil {
+			return cfg, nil
+		}
+	}
+	return ConfigFile{}, fmt.Errorf("no kssh config file found in any of your Keybase teams; pass --team explicitly")
+}
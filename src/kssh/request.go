@@ -0,0 +1,80 @@
+package kssh
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keybase/go-keybase-chat-bot/kbchat"
+)
+
+// replyTimeout bounds how long RequestCertificate waits for the CA bot to reply before giving up,
+// so a kssh invocation fails loudly instead of hanging forever if the bot is down.
+const replyTimeout = 30 * time.Second
+
+// RequestCertificate sends command (eg "!ssh sign <pubkey>" or "!ssh sign-profile <profile>
+// <pubkey>") to cfg's CA bot over Keybase chat and returns its reply, normally the signed
+// certificate. A "Failed to sign: ..." reply from the bot is returned as an error instead.
+func RequestCertificate(cfg ConfigFile, command string) (string, error) {
+	api, err := kbchat.Start(kbchat.RunOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to start the Keybase chat API: %v", err)
+	}
+	defer api.Shutdown()
+
+	sub, err := api.ListenForNewTextMessages()
+	if err != nil {
+		return "", fmt.Errorf("failed to listen for chat messages: %v", err)
+	}
+
+	var inChannel *string
+	if cfg.ChannelName != "" {
+		inChannel = &cfg.ChannelName
+	}
+	_, err = api.SendMessageByTeamName(cfg.TeamName, inChannel, "%s", command)
+	if err != nil {
+		return "", fmt.Errorf("failed to send sign request to %s: %v", cfg.BotName, err)
+	}
+
+	timeout := time.After(replyTimeout)
+	for {
+		select {
+		case reply := <-readReplyFrom(sub, cfg.BotName):
+			return reply.text, reply.err
+		case <-timeout:
+			return "", fmt.Errorf("timed out after %s waiting for %s to reply", replyTimeout, cfg.BotName)
+		}
+	}
+}
+
+type reply struct {
+	text string
+	err  error
+}
+
+// readReplyFrom reads chat messages from sub until it finds one from botUsername, skipping
+// messages from anyone else (eg other users also talking to the bot in the same channel), and
+// delivers the result on the returned channel.
+func readReplyFrom(sub *kbchat.Subscription, botUsername string) <-chan reply {
+	ch := make(chan reply, 1)
+	go func() {
+		for {
+			msg, err := sub.Read()
+			if err != nil {
+				ch <- reply{err: fmt.Errorf("failed to read the CA bot's reply: %v", err)}
+				return
+			}
+			if msg.Message.Sender.Username != botUsername || msg.Message.Content.Text == nil {
+				continue
+			}
+			body := strings.TrimSpace(msg.Message.Content.Text.Body)
+			if strings.HasPrefix(body, "Failed to sign:") {
+				ch <- reply{err: fmt.Errorf("%s", body)}
+				return
+			}
+			ch <- reply{text: body}
+			return
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,74 @@
+package kssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybase/bot-sshca/src/keybaseca/constants"
+	"github.com/keybase/bot-sshca/src/keybaseca/revocation"
+	"github.com/keybase/bot-sshca/src/keybaseca/rotation"
+)
+
+// trustedCAKeysFilename is the name of the trust bundle rotation.Rotate publishes alongside the
+// rotation manifest: one "ssh-ed25519 AAAA... keybaseca" line per CA public key currently trusted
+// for team, old and new both present for the duration of the grace period.
+const trustedCAKeysFilename = "trusted-ca-keys"
+
+// RotationStatus returns the rotation manifest currently published for team, so a kssh client can
+// tell whether the CA's old key is still trusted during a grace period
+// (!manifest.OldKeyRemoved) or has been dropped. found is false (with a nil error) if the CA for
+// team has never rotated, since no manifest has been published in that case.
+func RotationStatus(team string) (manifest *rotation.Manifest, found bool, err error) {
+	manifest, err = rotation.LoadManifestForTeam(team)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return manifest, true, nil
+}
+
+// TrustedCAKeys returns the CA public keys currently published to team's trust bundle, one per
+// line of the file rotation.Rotate writes. found is false (with a nil error) if the CA for team
+// has never rotated, since no trust bundle has been published yet in that case -- a kssh client
+// should fall back to whatever CA key it already trusts.
+func TrustedCAKeys(team string) (keys []string, found bool, err error) {
+	filename := filepath.Join("/keybase/team/", team, trustedCAKeysFilename)
+	content, err := constants.GetDefaultKBFSOperationsStruct().KBFSRead(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read trusted CA keys at %s: %w", filename, err)
+	}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			keys = append(keys, line)
+		}
+	}
+	return keys, true, nil
+}
+
+// RevocationStatus reports the revocation serial currently published for team and, if it differs
+// from lastSeenSerial (the serial kssh last refreshed its local KRL at), the current KRL contents
+// to refresh to. Pass lastSeenSerial as 0 to fetch the current KRL whenever anything has been
+// revoked; a published serial of 0 (nothing revoked) returns no KRL.
+func RevocationStatus(team string, lastSeenSerial uint64) (serial uint64, krl string, stale bool, err error) {
+	serial, err = revocation.ReadSerialForTeam(team)
+	if err != nil {
+		return 0, "", false, err
+	}
+	if serial == lastSeenSerial {
+		return serial, "", false, nil
+	}
+	krl, err = revocation.ReadKRLForTeam(team)
+	if err != nil {
+		return 0, "", false, err
+	}
+	return serial, krl, true, nil
+}
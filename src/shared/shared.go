@@ -0,0 +1,29 @@
+// Package shared holds small helpers and constants shared between the keybaseca server and the
+// kssh client, where duplicating them would risk the two sides silently drifting out of sync.
+package shared
+
+import "strings"
+
+// ConfigFilename is the name of the kssh client config file that keybaseca publishes to each
+// team's KBFS directory and kssh looks for there.
+const ConfigFilename = "keybaseca-config.json"
+
+// BoundedParallelismLimit caps how many KBFS operations keybaseca will have in flight at once when
+// fanning out across every team it can see, eg for `--wipe-all-configs`.
+const BoundedParallelismLimit = 10
+
+// TrustedUserCAKeysFilename is the name `provision-host` and `kssh request-host-cert` both use for
+// the TrustedUserCAKeys file they install alongside a host certificate.
+const TrustedUserCAKeysFilename = "keybaseca_trusted_user_ca_keys"
+
+// KeyPathToCert maps the path to an SSH key (eg `~/.ssh/id_rsa`) to the path ssh-keygen's
+// certificate convention expects for the certificate signed for it (`~/.ssh/id_rsa-cert.pub`).
+func KeyPathToCert(keyPath string) string {
+	return strings.TrimSuffix(keyPath, ".pub") + "-cert.pub"
+}
+
+// PubKeyPathToKeyPath strips the trailing `.pub` off a public key path, eg `~/.ssh/id_rsa.pub` ->
+// `~/.ssh/id_rsa`, matching ssh-keygen's convention of deriving file names from the private key.
+func PubKeyPathToKeyPath(pubKeyPath string) string {
+	return strings.TrimSuffix(pubKeyPath, ".pub")
+}
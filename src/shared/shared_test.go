@@ -0,0 +1,28 @@
+package shared
+
+import "testing"
+
+func TestKeyPathToCert(t *testing.T) {
+	got := KeyPathToCert("/home/alice/.ssh/id_ed25519.pub")
+	want := "/home/alice/.ssh/id_ed25519-cert.pub"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPubKeyPathToKeyPath(t *testing.T) {
+	got := PubKeyPathToKeyPath("/home/alice/.ssh/id_ed25519.pub")
+	want := "/home/alice/.ssh/id_ed25519"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestKeyPathToCertRoundTripsThroughPubKeyPathToKeyPath(t *testing.T) {
+	pubKeyPath := "/home/alice/.ssh/id_ed25519.pub"
+	got := KeyPathToCert(PubKeyPathToKeyPath(pubKeyPath))
+	want := "/home/alice/.ssh/id_ed25519-cert.pub"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}